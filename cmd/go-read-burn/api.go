@@ -0,0 +1,276 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/danstis/go-read-burn/internal/crypto"
+	"github.com/danstis/go-read-burn/internal/store"
+	"github.com/gorilla/mux"
+)
+
+// createSecretRequest is the body of a POST to /api/v1/secrets. Files are
+// uploaded as multipart/form-data with the same field names and the file in
+// the "file" field.
+type createSecretRequest struct {
+	Secret          string `json:"secret"`
+	TTL             string `json:"ttl,omitempty"`
+	ClientEncrypted bool   `json:"client_encrypted,omitempty"`
+	Passphrase      string `json:"passphrase,omitempty"`
+	Views           int    `json:"views,omitempty"`
+}
+
+// revealSecretRequest is the optional body of a POST to
+// /api/v1/secrets/{id}/reveal.
+type revealSecretRequest struct {
+	Passphrase string `json:"passphrase,omitempty"`
+}
+
+// createSecretResponse is returned when a secret is created through the API.
+type createSecretResponse struct {
+	ID        string    `json:"id"`
+	URL       string    `json:"url"`
+	ExpiresAt time.Time `json:"expires_at"`
+	Views     int       `json:"views"`
+}
+
+// revealSecretResponse is returned when a secret is revealed through the API.
+// Either Secret or File is set.
+type revealSecretResponse struct {
+	Secret          string           `json:"secret,omitempty"`
+	File            *apiFileResponse `json:"file,omitempty"`
+	ClientEncrypted bool             `json:"client_encrypted,omitempty"`
+	RemainingViews  int              `json:"remaining_views"`
+}
+
+// apiFileResponse is a revealed file attachment. Data is base64 encoded.
+type apiFileResponse struct {
+	Filename    string `json:"filename"`
+	ContentType string `json:"content_type"`
+	Data        []byte `json:"data"`
+}
+
+// apiErrorResponse is the body of every error returned by the API.
+type apiErrorResponse struct {
+	Error apiErrorDetail `json:"error"`
+}
+
+type apiErrorDetail struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func setupAPIRoutes(r *mux.Router) {
+	api := r.PathPrefix("/api/v1").Subrouter()
+	api.HandleFunc("/secrets", APICreateHandler).Methods("POST").Name(routeAPICreate)
+	api.HandleFunc("/secrets/{id}/reveal", APIRevealHandler).Methods("POST").Name(routeAPIReveal)
+}
+
+// APICreateHandler encrypts and stores the secret or file in the request body
+// and responds with its ID and share URL.
+func APICreateHandler(w http.ResponseWriter, r *http.Request) {
+	req, file, err := decodeCreateRequest(w, r)
+	switch {
+	case errors.Is(err, errSecretTooLarge):
+		writeAPIError(w, http.StatusRequestEntityTooLarge, "secret_too_large", fmt.Sprintf("secret may not be longer than %d bytes", config.MaxSecretSize))
+		return
+	case errors.Is(err, errFileTooLarge):
+		writeAPIError(w, http.StatusRequestEntityTooLarge, "file_too_large", fmt.Sprintf("file may not be larger than %d bytes", config.MaxFileSize))
+		return
+	case errors.Is(err, crypto.ErrEmptyPlaintext):
+		writeAPIError(w, http.StatusBadRequest, "empty_secret", err.Error())
+		return
+	case err != nil:
+		writeAPIError(w, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+
+	switch {
+	case req.Secret == "" && file == nil:
+		writeAPIError(w, http.StatusBadRequest, "empty_secret", crypto.ErrEmptyPlaintext.Error())
+		return
+	case req.Secret != "" && file != nil:
+		writeAPIError(w, http.StatusBadRequest, "invalid_request", "request may contain a secret or a file, not both")
+		return
+	case req.ClientEncrypted && file != nil:
+		writeAPIError(w, http.StatusBadRequest, "invalid_request", "client encryption is not supported for files")
+		return
+	}
+
+	if req.ClientEncrypted && !crypto.ValidateClientCiphertext(req.Secret) {
+		writeAPIError(w, http.StatusBadRequest, "invalid_ciphertext", "client encrypted secret must be base64 encoded AES-GCM output")
+		return
+	}
+	if secretTooLarge(req.Secret, req.ClientEncrypted) {
+		writeAPIError(w, http.StatusRequestEntityTooLarge, "secret_too_large", fmt.Sprintf("secret may not be longer than %d bytes", config.MaxSecretSize))
+		return
+	}
+
+	ttl, err := parseTTL(req.TTL)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, "invalid_ttl", err.Error())
+		return
+	}
+
+	views := req.Views
+	if views == 0 {
+		views = 1
+	}
+	if views < 1 || views > config.MaxViews {
+		writeAPIError(w, http.StatusBadRequest, "invalid_views", fmt.Sprintf("views must be between 1 and %d", config.MaxViews))
+		return
+	}
+
+	opts := secretOptions{
+		TTL:             ttl,
+		ClientEncrypted: req.ClientEncrypted,
+		Passphrase:      req.Passphrase,
+		Views:           views,
+	}
+	var fullID string
+	var expiresAt time.Time
+	if file != nil {
+		fullID, expiresAt, err = storeFile(r.Context(), *file, opts)
+	} else {
+		fullID, expiresAt, err = storeSecret(r.Context(), req.Secret, opts)
+	}
+	if err != nil {
+		writeAPIErrorFor(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, createSecretResponse{
+		ID:        fullID,
+		URL:       shareURL(r, fullID),
+		ExpiresAt: expiresAt,
+		Views:     views,
+	})
+}
+
+// APIRevealHandler decrypts and returns the secret with the given ID, burning
+// it in the process. Client encrypted secrets are returned as the ciphertext
+// that was submitted. The request body may supply the passphrase of a
+// passphrase protected secret.
+func APIRevealHandler(w http.ResponseWriter, r *http.Request) {
+	var req revealSecretRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxFormOverhead)).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		writeAPIError(w, http.StatusBadRequest, "invalid_request", "request body must be empty or a JSON object")
+		return
+	}
+
+	sec, err := burnSecret(r.Context(), mux.Vars(r)["id"], req.Passphrase)
+	if err != nil {
+		writeAPIErrorFor(w, err)
+		return
+	}
+
+	resp := revealSecretResponse{
+		Secret:          sec.Plaintext,
+		ClientEncrypted: sec.ClientEncrypted,
+		RemainingViews:  sec.RemainingViews,
+	}
+	if sec.File != nil {
+		resp.File = &apiFileResponse{
+			Filename:    sec.File.Name,
+			ContentType: sec.File.ContentType,
+			Data:        sec.File.Data,
+		}
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// decodeCreateRequest decodes a JSON or multipart/form-data create request,
+// returning the uploaded file of a multipart request if there is one. JSON
+// bodies are limited to maxSecretBodySize.
+func decodeCreateRequest(w http.ResponseWriter, r *http.Request) (createSecretRequest, *fileAttachment, error) {
+	var req createSecretRequest
+	if !isMultipart(r) {
+		limit := maxSecretBodySize()
+		if r.ContentLength > limit {
+			return req, nil, errSecretTooLarge
+		}
+		err := json.NewDecoder(http.MaxBytesReader(w, r.Body, limit)).Decode(&req)
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			return req, nil, errSecretTooLarge
+		}
+		if err != nil {
+			return req, nil, errors.New("request body must be a JSON object")
+		}
+		return req, nil, nil
+	}
+
+	file, err := parseCreateForm(w, r)
+	if errors.Is(err, errFileTooLarge) || errors.Is(err, crypto.ErrEmptyPlaintext) {
+		return req, nil, err
+	}
+	if err != nil {
+		return req, nil, errors.New("request body must be a valid multipart form")
+	}
+	req = createSecretRequest{
+		Secret:     r.FormValue("secret"),
+		TTL:        r.FormValue("ttl"),
+		Passphrase: r.FormValue("passphrase"),
+	}
+	if v := r.FormValue("client_encrypted"); v != "" {
+		clientEncrypted, err := strconv.ParseBool(v)
+		if err != nil {
+			return req, nil, errors.New("client_encrypted must be true or false")
+		}
+		req.ClientEncrypted = clientEncrypted
+	}
+	if v := r.FormValue("views"); v != "" {
+		views, err := strconv.Atoi(v)
+		if err != nil {
+			return req, nil, errors.New("views must be an integer")
+		}
+		req.Views = views
+	}
+	return req, file, nil
+}
+
+// writeAPIErrorFor writes the JSON error response matching err.
+func writeAPIErrorFor(w http.ResponseWriter, err error) {
+	var wrongPassphrase *wrongPassphraseError
+	switch {
+	case errors.Is(err, crypto.ErrInvalidIDLength), errors.Is(err, crypto.ErrInvalidIDCharacters),
+		errors.Is(err, crypto.ErrUnsupportedIDVersion), errors.Is(err, crypto.ErrInvalidIDEncoding):
+		writeAPIError(w, http.StatusBadRequest, "invalid_id", err.Error())
+	case errors.Is(err, crypto.ErrEmptyPlaintext):
+		writeAPIError(w, http.StatusBadRequest, "empty_secret", err.Error())
+	case errors.Is(err, store.ErrNotFound), errors.Is(err, crypto.ErrDecryptionFailed), errors.Is(err, crypto.ErrInvalidCiphertext):
+		// An ID that does not decrypt the secret stored under its key is
+		// reported like a missing one, so callers cannot probe for keys.
+		writeAPIError(w, http.StatusNotFound, "not_found", "secret does not exist, has expired or has already been viewed")
+	case errors.Is(err, errPassphraseRequired):
+		writeAPIError(w, http.StatusForbidden, "passphrase_required", err.Error())
+	case errors.As(err, &wrongPassphrase):
+		writeAPIError(w, http.StatusForbidden, "wrong_passphrase", err.Error())
+	case errors.Is(err, errTooManyAttempts):
+		writeAPIError(w, http.StatusGone, "too_many_attempts", err.Error())
+	case errors.Is(err, errBusy):
+		setRetryAfter(w, config.KDFQueueTimeout)
+		writeAPIError(w, http.StatusServiceUnavailable, "server_busy", err.Error())
+	default:
+		log.Printf("api request failed: %v", err)
+		writeAPIError(w, http.StatusInternalServerError, "internal_error", "internal server error")
+	}
+}
+
+func writeAPIError(w http.ResponseWriter, status int, code, message string) {
+	writeJSON(w, status, apiErrorResponse{Error: apiErrorDetail{Code: code, Message: message}})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("failed to write JSON response: %v", err)
+	}
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/danstis/go-read-burn/internal/crypto"
+)
+
+func doAPIRequest(t *testing.T, h http.Handler, method, target, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestAPI_CreateAndReveal(t *testing.T) {
+	r := newTestRouter(t)
+
+	rr := doAPIRequest(t, r, "POST", "http://example.com/api/v1/secrets", `{"secret":"api secret","ttl":"1h"}`)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("create: got status %v want %v: %s", rr.Code, http.StatusCreated, rr.Body.String())
+	}
+	if ct := rr.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("create: Content-Type = %q, want application/json", ct)
+	}
+
+	var created createSecretResponse
+	if err := json.NewDecoder(rr.Body).Decode(&created); err != nil {
+		t.Fatalf("create: invalid response: %v", err)
+	}
+	if !crypto.ValidateID(created.ID) {
+		t.Errorf("create: invalid ID %q", created.ID)
+	}
+	if created.URL != "http://example.com/get/"+created.ID {
+		t.Errorf("create: URL = %q", created.URL)
+	}
+	if ttl := time.Until(created.ExpiresAt); ttl <= 59*time.Minute || ttl > time.Hour {
+		t.Errorf("create: secret expires in %v, want 1h", ttl)
+	}
+
+	rr = doAPIRequest(t, r, "POST", "/api/v1/secrets/"+created.ID+"/reveal", "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("reveal: got status %v want %v: %s", rr.Code, http.StatusOK, rr.Body.String())
+	}
+	var revealed revealSecretResponse
+	if err := json.NewDecoder(rr.Body).Decode(&revealed); err != nil {
+		t.Fatalf("reveal: invalid response: %v", err)
+	}
+	if revealed.Secret != "api secret" {
+		t.Errorf("reveal: secret = %q, want %q", revealed.Secret, "api secret")
+	}
+
+	rr = doAPIRequest(t, r, "POST", "/api/v1/secrets/"+created.ID+"/reveal", "")
+	assertAPIError(t, rr, http.StatusNotFound, "not_found")
+}
+
+func TestAPI_Errors(t *testing.T) {
+	r := newTestRouter(t)
+
+	fullID, _, err := storeSecret(t.Context(), "guarded", secretOptions{TTL: time.Hour})
+	if err != nil {
+		t.Fatalf("storeSecret() error: %v", err)
+	}
+	wrongID := withWrongPassword(t, fullID)
+
+	tests := []struct {
+		name       string
+		target     string
+		body       string
+		wantStatus int
+		wantCode   string
+	}{
+		{"malformed JSON", "/api/v1/secrets", `{"secret":`, http.StatusBadRequest, "invalid_request"},
+		{"empty secret", "/api/v1/secrets", `{"secret":""}`, http.StatusBadRequest, "empty_secret"},
+		{"invalid ttl", "/api/v1/secrets", `{"secret":"s","ttl":"forever"}`, http.StatusBadRequest, "invalid_ttl"},
+		{"ttl above maximum", "/api/v1/secrets", `{"secret":"s","ttl":"8760h"}`, http.StatusBadRequest, "invalid_ttl"},
+		{"negative views", "/api/v1/secrets", `{"secret":"s","views":-1}`, http.StatusBadRequest, "invalid_views"},
+		{"views above maximum", "/api/v1/secrets", `{"secret":"s","views":1000}`, http.StatusBadRequest, "invalid_views"},
+		{"malformed client ciphertext", "/api/v1/secrets", `{"secret":"s","client_encrypted":true}`, http.StatusBadRequest, "invalid_ciphertext"},
+		{"short ID", "/api/v1/secrets/abc/reveal", "", http.StatusBadRequest, "invalid_id"},
+		{"unsupported version", "/api/v1/secrets/z" + strings.Repeat("a", crypto.LegacyIDLength) + "/reveal", "", http.StatusBadRequest, "invalid_id"},
+		{"invalid characters", "/api/v1/secrets/" + strings.Repeat("-", crypto.FullIDLength) + "/reveal", "", http.StatusBadRequest, "invalid_id"},
+		{"unknown secret", "/api/v1/secrets/1" + strings.Repeat("a", crypto.LegacyIDLength) + "/reveal", "", http.StatusNotFound, "not_found"},
+		{"wrong password", "/api/v1/secrets/" + wrongID + "/reveal", "", http.StatusNotFound, "not_found"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := doAPIRequest(t, r, "POST", tt.target, tt.body)
+			assertAPIError(t, rr, tt.wantStatus, tt.wantCode)
+		})
+	}
+
+	if _, err := burnSecret(t.Context(), fullID, ""); err != nil {
+		t.Errorf("secret was lost after failed reveal attempts: %v", err)
+	}
+}
+
+func TestAPI_Passphrase(t *testing.T) {
+	r := newTestRouter(t)
+	config.MaxPassphraseAttempts = 2
+
+	rr := doAPIRequest(t, r, "POST", "/api/v1/secrets", `{"secret":"api passphrase","passphrase":"pw"}`)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("create: got status %v want %v: %s", rr.Code, http.StatusCreated, rr.Body.String())
+	}
+	var created createSecretResponse
+	if err := json.NewDecoder(rr.Body).Decode(&created); err != nil {
+		t.Fatalf("create: invalid response: %v", err)
+	}
+	target := "/api/v1/secrets/" + created.ID + "/reveal"
+
+	assertAPIError(t, doAPIRequest(t, r, "POST", target, ""), http.StatusForbidden, "passphrase_required")
+	assertAPIError(t, doAPIRequest(t, r, "POST", target, `{"passphrase":`), http.StatusBadRequest, "invalid_request")
+	assertAPIError(t, doAPIRequest(t, r, "POST", target, `{"passphrase":"nope"}`), http.StatusForbidden, "wrong_passphrase")
+
+	rr = doAPIRequest(t, r, "POST", target, `{"passphrase":"pw"}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("reveal: got status %v want %v: %s", rr.Code, http.StatusOK, rr.Body.String())
+	}
+
+	rr = doAPIRequest(t, r, "POST", "/api/v1/secrets", `{"secret":"burn me","passphrase":"pw"}`)
+	if err := json.NewDecoder(rr.Body).Decode(&created); err != nil {
+		t.Fatalf("create: invalid response: %v", err)
+	}
+	target = "/api/v1/secrets/" + created.ID + "/reveal"
+	assertAPIError(t, doAPIRequest(t, r, "POST", target, `{"passphrase":"a"}`), http.StatusForbidden, "wrong_passphrase")
+	assertAPIError(t, doAPIRequest(t, r, "POST", target, `{"passphrase":"b"}`), http.StatusGone, "too_many_attempts")
+	assertAPIError(t, doAPIRequest(t, r, "POST", target, `{"passphrase":"pw"}`), http.StatusNotFound, "not_found")
+}
+
+func TestAPI_PassphraseNotRequired(t *testing.T) {
+	r := newTestRouter(t)
+
+	rr := doAPIRequest(t, r, "POST", "/api/v1/secrets", `{"secret":"plain"}`)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("create: got status %v want %v: %s", rr.Code, http.StatusCreated, rr.Body.String())
+	}
+	var created createSecretResponse
+	if err := json.NewDecoder(rr.Body).Decode(&created); err != nil {
+		t.Fatalf("create: invalid response: %v", err)
+	}
+
+	rr = doAPIRequest(t, r, "POST", "/api/v1/secrets/"+created.ID+"/reveal", `{"passphrase":"unused"}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("reveal: got status %v want %v: %s", rr.Code, http.StatusOK, rr.Body.String())
+	}
+	var revealed revealSecretResponse
+	if err := json.NewDecoder(rr.Body).Decode(&revealed); err != nil {
+		t.Fatalf("reveal: invalid response: %v", err)
+	}
+	if revealed.Secret != "plain" {
+		t.Errorf("reveal: got secret %q want %q", revealed.Secret, "plain")
+	}
+}
+
+func TestAPI_File(t *testing.T) {
+	r := newTestRouter(t)
+
+	data := []byte{0x30, 0x82, 0x00, 0xff}
+	req := newUploadRequest(t, "/api/v1/secrets", map[string]string{"views": "2"}, "cert.p12", data)
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("create: got status %v want %v: %s", rr.Code, http.StatusCreated, rr.Body.String())
+	}
+	var created createSecretResponse
+	if err := json.NewDecoder(rr.Body).Decode(&created); err != nil {
+		t.Fatalf("create: invalid response: %v", err)
+	}
+	if created.Views != 2 {
+		t.Errorf("create: views = %d, want 2", created.Views)
+	}
+
+	rr = doAPIRequest(t, r, "POST", "/api/v1/secrets/"+created.ID+"/reveal", "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("reveal: got status %v want %v: %s", rr.Code, http.StatusOK, rr.Body.String())
+	}
+	var revealed revealSecretResponse
+	if err := json.NewDecoder(rr.Body).Decode(&revealed); err != nil {
+		t.Fatalf("reveal: invalid response: %v", err)
+	}
+	if revealed.File == nil || revealed.File.Filename != "cert.p12" || !bytes.Equal(revealed.File.Data, data) {
+		t.Errorf("reveal: file = %+v, want cert.p12 with %x", revealed.File, data)
+	}
+	if revealed.Secret != "" || revealed.RemainingViews != 1 {
+		t.Errorf("reveal: secret = %q, remaining views = %d", revealed.Secret, revealed.RemainingViews)
+	}
+
+	config.MaxFileSize = 2
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, newUploadRequest(t, "/api/v1/secrets", nil, "cert.p12", data))
+	assertAPIError(t, rr, http.StatusRequestEntityTooLarge, "file_too_large")
+
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, newUploadRequest(t, "/api/v1/secrets", map[string]string{"views": "two"}, "", nil))
+	assertAPIError(t, rr, http.StatusBadRequest, "invalid_request")
+
+	// Multipart requests honour client_encrypted like JSON ones.
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, newUploadRequest(t, "/api/v1/secrets", map[string]string{"secret": "s", "client_encrypted": "true"}, "", nil))
+	assertAPIError(t, rr, http.StatusBadRequest, "invalid_ciphertext")
+
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, newUploadRequest(t, "/api/v1/secrets", map[string]string{"client_encrypted": "true"}, "cert.p12", []byte{0x01}))
+	assertAPIError(t, rr, http.StatusBadRequest, "invalid_request")
+
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, newUploadRequest(t, "/api/v1/secrets", map[string]string{"secret": "s", "client_encrypted": "maybe"}, "", nil))
+	assertAPIError(t, rr, http.StatusBadRequest, "invalid_request")
+}
+
+func TestAPI_SecretTooLarge(t *testing.T) {
+	r := newTestRouter(t)
+	config.MaxSecretSize = 16
+
+	rr := doAPIRequest(t, r, "POST", "/api/v1/secrets", `{"secret":"`+strings.Repeat("a", 16)+`"}`)
+	if rr.Code != http.StatusCreated {
+		t.Errorf("at limit: got status %v want %v: %s", rr.Code, http.StatusCreated, rr.Body.String())
+	}
+
+	rr = doAPIRequest(t, r, "POST", "/api/v1/secrets", `{"secret":"`+strings.Repeat("a", 17)+`"}`)
+	assertAPIError(t, rr, http.StatusRequestEntityTooLarge, "secret_too_large")
+
+	rr = doAPIRequest(t, r, "POST", "/api/v1/secrets", `{"secret":"`+strings.Repeat("a", int(maxSecretBodySize()))+`"}`)
+	assertAPIError(t, rr, http.StatusRequestEntityTooLarge, "secret_too_large")
+
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, newUploadRequest(t, "/api/v1/secrets", map[string]string{"secret": strings.Repeat("a", 17)}, "", nil))
+	assertAPIError(t, rr, http.StatusRequestEntityTooLarge, "secret_too_large")
+}
+
+func assertAPIError(t *testing.T, rr *httptest.ResponseRecorder, wantStatus int, wantCode string) {
+	t.Helper()
+	if rr.Code != wantStatus {
+		t.Errorf("got status %v want %v: %s", rr.Code, wantStatus, rr.Body.String())
+	}
+	var resp apiErrorResponse
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatalf("invalid error response: %v", err)
+	}
+	if resp.Error.Code != wantCode {
+		t.Errorf("error code = %q, want %q", resp.Error.Code, wantCode)
+	}
+	if resp.Error.Message == "" {
+		t.Error("error message is empty")
+	}
+}
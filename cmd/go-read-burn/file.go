@@ -0,0 +1,272 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+
+	"github.com/danstis/go-read-burn/internal/crypto"
+)
+
+// maxFormOverhead is the allowance for the other fields and the encoding of a
+// create request, on top of Config.MaxFileSize or maxSecretBodySize.
+const maxFormOverhead = 1 << 20
+
+var (
+	errFileTooLarge   = errors.New("file is too large")
+	errInvalidPayload = errors.New("invalid file payload")
+)
+
+// fileAttachment is a file shared as a secret.
+type fileAttachment struct {
+	Name        string
+	ContentType string
+	Data        []byte
+
+	// payload is the encodeFile encoding of the file with Data at its end,
+	// set by readFilePart.
+	payload []byte
+}
+
+// fileHeader holds the metadata of a fileAttachment. It is stored in front of
+// the file data and encrypted with it, so the filename and content type are
+// never stored in the clear.
+type fileHeader struct {
+	Name        string `json:"name"`
+	ContentType string `json:"content_type"`
+}
+
+// encodeFileHeader returns the encoding of a file's length-prefixed header,
+// with capacity for size more bytes of data to be appended.
+func encodeFileHeader(name, contentType string, size int) ([]byte, error) {
+	header, err := json.Marshal(fileHeader{Name: name, ContentType: contentType})
+	if err != nil {
+		return nil, err
+	}
+
+	payload := make([]byte, 4, 4+len(header)+size)
+	binary.BigEndian.PutUint32(payload, uint32(len(header)))
+	return append(payload, header...), nil
+}
+
+// encodeFile serialises f as a 4-byte big-endian header length, the JSON
+// encoded fileHeader and the file data, ready to be encrypted as one payload.
+func encodeFile(f fileAttachment) ([]byte, error) {
+	if f.payload != nil {
+		return f.payload, nil
+	}
+	payload, err := encodeFileHeader(f.Name, f.ContentType, len(f.Data))
+	if err != nil {
+		return nil, err
+	}
+	return append(payload, f.Data...), nil
+}
+
+// decodeFile reverses encodeFile.
+func decodeFile(payload []byte) (fileAttachment, error) {
+	if len(payload) < 4 {
+		return fileAttachment{}, errInvalidPayload
+	}
+	n := binary.BigEndian.Uint32(payload)
+	if uint64(n) > uint64(len(payload)-4) {
+		return fileAttachment{}, errInvalidPayload
+	}
+
+	var header fileHeader
+	if err := json.Unmarshal(payload[4:4+n], &header); err != nil {
+		return fileAttachment{}, errInvalidPayload
+	}
+	return fileAttachment{
+		Name:        header.Name,
+		ContentType: header.ContentType,
+		Data:        payload[4+n:],
+	}, nil
+}
+
+// parseCreateForm parses the form of a create request, refusing bodies larger
+// than the limit before they are read, so an oversized request is never
+// buffered. Multipart forms may carry a file and are limited to
+// Config.MaxFileSize plus maxFormOverhead, other forms to maxSecretBodySize.
+// The file uploaded in the "file" field of a multipart form is returned, or
+// nil if no file was uploaded.
+func parseCreateForm(w http.ResponseWriter, r *http.Request) (*fileAttachment, error) {
+	limit, tooLarge := maxSecretBodySize(), errSecretTooLarge
+	multipart := isMultipart(r)
+	if multipart {
+		limit, tooLarge = config.MaxFileSize+maxFormOverhead, errFileTooLarge
+	}
+	if r.ContentLength > limit {
+		return nil, tooLarge
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, limit)
+
+	var file *fileAttachment
+	var err error
+	if multipart {
+		file, err = readMultipartForm(r)
+	} else {
+		err = r.ParseForm()
+	}
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return nil, tooLarge
+	}
+	return file, err
+}
+
+// readMultipartForm reads a multipart create request part by part, unlike
+// http.Request.ParseMultipartForm, which writes large files to disk. The
+// fields are stored in r.Form and r.PostForm, and the "file" field is read
+// by readFilePart.
+func readMultipartForm(r *http.Request) (*fileAttachment, error) {
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return nil, err
+	}
+
+	form := make(url.Values)
+	var file *fileAttachment
+	for {
+		part, err := mr.NextPart()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		// Browsers submit the file field as an unnamed value when no file is
+		// selected.
+		switch name := part.FormName(); {
+		case part.FileName() == "":
+			value, err := io.ReadAll(part)
+			if err != nil {
+				return nil, err
+			}
+			form.Add(name, string(value))
+		case name == "file":
+			if file != nil {
+				return nil, errors.New("only one file can be uploaded")
+			}
+			if file, err = readFilePart(part, r.ContentLength); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	r.PostForm = form
+	r.Form = make(url.Values, len(form))
+	for k, v := range form {
+		r.Form[k] = append(r.Form[k], v...)
+	}
+	for k, v := range r.URL.Query() {
+		r.Form[k] = append(r.Form[k], v...)
+	}
+	return file, nil
+}
+
+// readFilePart reads an uploaded file straight into its encoding, so it is
+// held in memory once and never written to disk. The encoding is sized from
+// the request's Content-Length, if known. An empty file is rejected with
+// crypto.ErrEmptyPlaintext.
+func readFilePart(part *multipart.Part, contentLength int64) (*fileAttachment, error) {
+	size := config.MaxFileSize
+	if contentLength >= 0 && contentLength < size {
+		size = contentLength
+	}
+	name, contentType := sanitizeFilename(part.FileName()), part.Header.Get("Content-Type")
+	header, err := encodeFileHeader(name, contentType, int(size)+bytes.MinRead)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := bytes.NewBuffer(header)
+	n, err := buf.ReadFrom(io.LimitReader(part, config.MaxFileSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if n > config.MaxFileSize {
+		return nil, errFileTooLarge
+	}
+	if n == 0 {
+		return nil, crypto.ErrEmptyPlaintext
+	}
+
+	payload := buf.Bytes()
+	return &fileAttachment{Name: name, ContentType: contentType, Data: payload[len(header):], payload: payload}, nil
+}
+
+// maxSecretBodySize is the largest create request body without a file that is
+// read. Escaping can grow each byte of the secret to up to six bytes in JSON,
+// and browser encryption adds base64 encoding, so the limit is generous; the
+// secret itself is checked against Config.MaxSecretSize once decoded.
+func maxSecretBodySize() int64 {
+	return 6*config.MaxSecretSize + maxFormOverhead
+}
+
+// isMultipart reports whether the request body is multipart/form-data.
+func isMultipart(r *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return err == nil && mediaType == "multipart/form-data"
+}
+
+// sanitizeFilename strips any directory components and control characters
+// from an uploaded filename.
+func sanitizeFilename(name string) string {
+	name = filepath.Base(strings.ReplaceAll(name, "\\", "/"))
+	name = strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f {
+			return -1
+		}
+		return r
+	}, name)
+	if name == "" || name == "." || name == "/" {
+		return "secret"
+	}
+	return name
+}
+
+// serveFile writes f as a download. The stored content type is only used if
+// it is well-formed, and the response is always an attachment with sniffing
+// disabled, so an uploaded file cannot be rendered by the browser.
+func serveFile(w http.ResponseWriter, f *fileAttachment) {
+	contentType := "application/octet-stream"
+	if mediaType, params, err := mime.ParseMediaType(f.ContentType); err == nil {
+		contentType = mime.FormatMediaType(mediaType, params)
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	disposition := mime.FormatMediaType("attachment", map[string]string{"filename": f.Name})
+	if disposition == "" {
+		disposition = "attachment"
+	}
+	w.Header().Set("Content-Disposition", disposition)
+	w.Header().Set("Content-Length", fmt.Sprint(len(f.Data)))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Cache-Control", "no-store")
+	if _, err := w.Write(f.Data); err != nil {
+		log.Printf("failed to write file: %v", err)
+	}
+}
+
+// formatSize formats a size in bytes for display.
+func formatSize(n int64) string {
+	switch {
+	case n >= 1<<20 && n%(1<<20) == 0:
+		return fmt.Sprintf("%d MiB", n>>20)
+	case n >= 1<<10 && n%(1<<10) == 0:
+		return fmt.Sprintf("%d KiB", n>>10)
+	default:
+		return fmt.Sprintf("%d bytes", n)
+	}
+}
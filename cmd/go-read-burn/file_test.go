@@ -0,0 +1,237 @@
+package main
+
+import (
+	"bytes"
+	"html/template"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+// newUploadRequest builds a multipart/form-data POST to target with the given
+// fields and a file named filename, if set.
+func newUploadRequest(t *testing.T, target string, fields map[string]string, filename string, data []byte) *http.Request {
+	t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for k, v := range fields {
+		if err := mw.WriteField(k, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if filename != "" {
+		fw, err := mw.CreateFormFile("file", filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := fw.Write(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := mw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest("POST", target, &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	return req
+}
+
+func TestEncodeDecodeFile(t *testing.T) {
+	f := fileAttachment{Name: "id_ed25519", ContentType: "application/x-pem-file", Data: []byte{0x00, 0x01, 0xff}}
+
+	payload, err := encodeFile(f)
+	if err != nil {
+		t.Fatalf("encodeFile() error: %v", err)
+	}
+	got, err := decodeFile(payload)
+	if err != nil {
+		t.Fatalf("decodeFile() error: %v", err)
+	}
+	if got.Name != f.Name || got.ContentType != f.ContentType || !bytes.Equal(got.Data, f.Data) {
+		t.Errorf("decodeFile() = %+v, want %+v", got, f)
+	}
+
+	for _, bad := range [][]byte{nil, {0, 0}, {0, 0, 0, 99, '{'}, {0, 0, 0, 1, '{'}} {
+		if _, err := decodeFile(bad); err != errInvalidPayload {
+			t.Errorf("decodeFile(%v) error = %v, want %v", bad, err, errInvalidPayload)
+		}
+	}
+}
+
+func TestParseCreateForm(t *testing.T) {
+	setupTestConfig(t)
+	tmp := t.TempDir()
+	t.Setenv("TMPDIR", tmp)
+
+	// Large enough that http.Request.ParseMultipartForm would spool it to disk.
+	data := bytes.Repeat([]byte{0xa5}, 8<<20)
+	req := newUploadRequest(t, "http://example.com/create?views=3", map[string]string{"ttl": "1h", "views": "2"}, "backup.tar", data)
+	f, err := parseCreateForm(httptest.NewRecorder(), req)
+	if err != nil {
+		t.Fatalf("parseCreateForm() error: %v", err)
+	}
+	if entries, _ := os.ReadDir(tmp); len(entries) > 0 {
+		t.Errorf("the upload was written to disk as %s", entries[0].Name())
+	}
+	if got := req.FormValue("ttl"); got != "1h" {
+		t.Errorf("FormValue(ttl) = %q, want %q", got, "1h")
+	}
+	if got := req.Form["views"]; len(got) != 2 || got[0] != "2" {
+		t.Errorf("Form[views] = %q, want the posted value first", got)
+	}
+
+	if f.Name != "backup.tar" || !bytes.Equal(f.Data, data) {
+		t.Fatalf("parseCreateForm() = %q with %d bytes, want %q with %d", f.Name, len(f.Data), "backup.tar", len(data))
+	}
+	payload, err := encodeFile(*f)
+	if err != nil {
+		t.Fatalf("encodeFile() error: %v", err)
+	}
+	want, _ := encodeFile(fileAttachment{Name: f.Name, ContentType: f.ContentType, Data: data})
+	if !bytes.Equal(payload, want) {
+		t.Error("encodeFile() of an upload differs from encoding a copy of it")
+	}
+	if &payload[len(payload)-1] != &f.Data[len(f.Data)-1] {
+		t.Error("encodeFile() copied the uploaded data")
+	}
+}
+
+func TestSanitizeFilename(t *testing.T) {
+	tests := map[string]string{
+		"kubeconfig":              "kubeconfig",
+		"../../etc/passwd":        "passwd",
+		`C:\Users\me\cert.p12`:    "cert.p12",
+		"evil\r\nname.txt":        "evilname.txt",
+		"":                        "secret",
+		"/":                       "secret",
+		"spaces in name (1).json": "spaces in name (1).json",
+	}
+	for in, want := range tests {
+		if got := sanitizeFilename(in); got != want {
+			t.Errorf("sanitizeFilename(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestFormatSize(t *testing.T) {
+	tests := map[int64]string{
+		10 << 20:  "10 MiB",
+		512 << 10: "512 KiB",
+		1000:      "1000 bytes",
+	}
+	for in, want := range tests {
+		if got := formatSize(in); got != want {
+			t.Errorf("formatSize(%d) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestFileSecret_UploadAndDownload(t *testing.T) {
+	templates = template.Must(template.ParseFS(views, "views/*.html"))
+	setupTestConfig(t)
+	setupTestDB(t)
+
+	data := []byte("apiVersion: v1\nkind: Config\n")
+	req := newUploadRequest(t, "http://example.com/create", map[string]string{"ttl": "1h"}, "kubeconfig.yaml", data)
+	rr := httptest.NewRecorder()
+	CreateHandler(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("create: got status %v want %v: %s", rr.Code, http.StatusOK, rr.Body.String())
+	}
+	m := regexp.MustCompile(`value="http://example\.com/get/([0-9a-zA-Z]+)"`).FindStringSubmatch(rr.Body.String())
+	if m == nil {
+		t.Fatalf("share URL not found in body: %s", rr.Body.String())
+	}
+
+	if n := countSecrets(t); n != 1 {
+		t.Fatalf("%d secrets stored, want 1", n)
+	}
+	if stored := storedRecord(t, m[1]).Ciphertext; bytes.Contains(stored, []byte("kubeconfig.yaml")) || bytes.Contains(stored, []byte("apiVersion")) {
+		t.Error("the filename or file contents are stored in the clear")
+	}
+
+	req = httptest.NewRequest("GET", "/get/"+m[1], nil)
+	req = mux.SetURLVars(req, map[string]string{"key": m[1]})
+	rr = httptest.NewRecorder()
+	RevealHandler(rr, req)
+	if !strings.Contains(rr.Body.String(), "Download file") {
+		t.Errorf("reveal page does not offer a download: %s", rr.Body.String())
+	}
+
+	download := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/get/"+m[1], nil)
+		req = mux.SetURLVars(req, map[string]string{"key": m[1]})
+		rr := httptest.NewRecorder()
+		SecretHandler(rr, req)
+		return rr
+	}
+
+	rr = download()
+	if rr.Code != http.StatusOK {
+		t.Fatalf("download: got status %v want %v", rr.Code, http.StatusOK)
+	}
+	if !bytes.Equal(rr.Body.Bytes(), data) {
+		t.Errorf("download: body = %q, want %q", rr.Body.Bytes(), data)
+	}
+	if cd := rr.Header().Get("Content-Disposition"); cd != `attachment; filename=kubeconfig.yaml` {
+		t.Errorf("download: Content-Disposition = %q", cd)
+	}
+	if ct := rr.Header().Get("Content-Type"); ct != "application/octet-stream" {
+		t.Errorf("download: Content-Type = %q, want application/octet-stream", ct)
+	}
+	if rr.Header().Get("X-Content-Type-Options") != "nosniff" {
+		t.Error("download: X-Content-Type-Options is not nosniff")
+	}
+
+	if rr = download(); rr.Code != http.StatusNotFound {
+		t.Errorf("second download: got status %v want %v", rr.Code, http.StatusNotFound)
+	}
+}
+
+func TestFileSecret_BadUploads(t *testing.T) {
+	templates = template.Must(template.ParseFS(views, "views/*.html"))
+	setupTestConfig(t)
+	setupTestDB(t)
+	config.MaxFileSize = 1024
+
+	tests := []struct {
+		name       string
+		fields     map[string]string
+		filename   string
+		data       []byte
+		wantStatus int
+		wantMsg    string
+	}{
+		{"file too large", nil, "big.bin", make([]byte, 1025), http.StatusRequestEntityTooLarge, "may not be larger than 1 KiB"},
+		{"body too large", nil, "huge.bin", make([]byte, 1024+maxFormOverhead), http.StatusRequestEntityTooLarge, "may not be larger than 1 KiB"},
+		{"empty file", nil, "empty.txt", nil, http.StatusBadRequest, "The file is empty."},
+		{"text and file", map[string]string{"inputText": "text"}, "a.txt", []byte("a"), http.StatusBadRequest, "not both"},
+		{"browser encrypted file", map[string]string{"clientEncrypted": "true"}, "a.txt", []byte("a"), http.StatusBadRequest, "not supported for files"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := newUploadRequest(t, "/create", tt.fields, tt.filename, tt.data)
+			rr := httptest.NewRecorder()
+			CreateHandler(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Errorf("got status %v want %v", rr.Code, tt.wantStatus)
+			}
+			if !strings.Contains(rr.Body.String(), tt.wantMsg) {
+				t.Errorf("expected error %q, got: %s", tt.wantMsg, rr.Body.String())
+			}
+		})
+	}
+
+	if n := countSecrets(t); n != 0 {
+		t.Errorf("%d secrets stored from bad uploads, want 0", n)
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// hstsMaxAge is the Strict-Transport-Security max-age, two years.
+const hstsMaxAge = "63072000"
+
+// cdnOrigin serves the Bootstrap and jQuery assets used by the pages.
+const cdnOrigin = "https://cdn.jsdelivr.net"
+
+// noStoreRoutes are the routes whose responses contain a secret, a link to
+// one or the key to read one, and must never be cached.
+var noStoreRoutes = map[string]bool{
+	routeCreate:    true,
+	routeReveal:    true,
+	routeSecret:    true,
+	routeAPICreate: true,
+	routeAPIReveal: true,
+}
+
+// nonceKey is the context key of the request's script nonce.
+type nonceKey struct{}
+
+// securityHeadersMiddleware sets the security headers of every response. The
+// Content-Security-Policy only allows scripts from this server, the CDN and
+// inline scripts carrying the request's nonce, which pages read with
+// cspNonce.
+func securityHeadersMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		nonce := newNonce()
+		h := w.Header()
+		h.Set("Content-Security-Policy", contentSecurityPolicy(nonce))
+		h.Set("X-Frame-Options", "DENY")
+		h.Set("X-Content-Type-Options", "nosniff")
+		h.Set("Referrer-Policy", "no-referrer")
+		if isHTTPS(r) {
+			h.Set("Strict-Transport-Security", "max-age="+hstsMaxAge)
+		}
+		if route := mux.CurrentRoute(r); route != nil && noStoreRoutes[route.GetName()] {
+			h.Set("Cache-Control", "no-store")
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), nonceKey{}, nonce)))
+	})
+}
+
+// contentSecurityPolicy returns the policy allowing inline scripts with nonce.
+func contentSecurityPolicy(nonce string) string {
+	return "default-src 'none'; " +
+		"script-src 'self' 'nonce-" + nonce + "' " + cdnOrigin + "; " +
+		"style-src 'self' " + cdnOrigin + "; " +
+		"img-src 'self' data:; " +
+		"connect-src 'self'; " +
+		"form-action 'self'; " +
+		"frame-ancestors 'none'; " +
+		"base-uri 'none'"
+}
+
+// newNonce returns a random script nonce.
+func newNonce() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// cspNonce returns the script nonce of r, for the nonce attribute of inline
+// scripts.
+func cspNonce(r *http.Request) string {
+	nonce, _ := r.Context().Value(nonceKey{}).(string)
+	return nonce
+}
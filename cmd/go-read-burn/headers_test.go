@@ -0,0 +1,152 @@
+package main
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+var cspNoncePattern = regexp.MustCompile(`'nonce-([A-Za-z0-9_-]+)'`)
+
+func TestSecurityHeaders(t *testing.T) {
+	r := newTestRouter(t)
+
+	for _, target := range []string{"/", "/healthz", "/unknown"} {
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, httptest.NewRequest("GET", target, nil))
+
+		want := map[string]string{
+			"X-Frame-Options":        "DENY",
+			"X-Content-Type-Options": "nosniff",
+			"Referrer-Policy":        "no-referrer",
+		}
+		for k, v := range want {
+			if got := rr.Header().Get(k); got != v {
+				t.Errorf("%s: %s = %q, want %q", target, k, got, v)
+			}
+		}
+		csp := rr.Header().Get("Content-Security-Policy")
+		for _, directive := range []string{"default-src 'none'", "frame-ancestors 'none'", "base-uri 'none'", "script-src 'self' 'nonce-"} {
+			if !strings.Contains(csp, directive) {
+				t.Errorf("%s: Content-Security-Policy %q does not contain %q", target, csp, directive)
+			}
+		}
+		if strings.Contains(csp, "unsafe-inline") || strings.Contains(csp, "unsafe-eval") {
+			t.Errorf("%s: Content-Security-Policy %q allows unsafe scripts", target, csp)
+		}
+		if got := rr.Header().Get("Strict-Transport-Security"); got != "" {
+			t.Errorf("%s: Strict-Transport-Security = %q over plain HTTP, want none", target, got)
+		}
+	}
+}
+
+func TestSecurityHeaders_Nonce(t *testing.T) {
+	r := newTestRouter(t)
+
+	var nonces []string
+	for range 2 {
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+		m := cspNoncePattern.FindStringSubmatch(rr.Header().Get("Content-Security-Policy"))
+		if m == nil {
+			t.Fatalf("no nonce in Content-Security-Policy %q", rr.Header().Get("Content-Security-Policy"))
+		}
+		body := rr.Body.String()
+		if n, want := strings.Count(body, `nonce="`+m[1]+`"`), strings.Count(body, "<script type=\"text/javascript\" nonce="); n != want || n == 0 {
+			t.Errorf("%d inline scripts carry the policy nonce, want %d", n, want)
+		}
+		nonces = append(nonces, m[1])
+	}
+	if nonces[0] == nonces[1] {
+		t.Errorf("nonce %q reused across requests", nonces[0])
+	}
+}
+
+func TestSecurityHeaders_HSTS(t *testing.T) {
+	r := newTestRouter(t)
+	prev := trustedProxies
+	t.Cleanup(func() { trustedProxies = prev })
+	trustedProxies = []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		tls        bool
+		proto      string
+		want       bool
+	}{
+		{"TLS", "192.0.2.1:1234", true, "", true},
+		{"trusted proxy", "10.1.2.3:1234", false, "https", true},
+		{"trusted proxy over HTTP", "10.1.2.3:1234", false, "http", false},
+		{"untrusted sender", "192.0.2.1:1234", false, "https", false},
+		{"plain HTTP", "192.0.2.1:1234", false, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			if tt.tls {
+				req.TLS = &tls.ConnectionState{}
+			}
+			if tt.proto != "" {
+				req.Header.Set("X-Forwarded-Proto", tt.proto)
+			}
+
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, req)
+			want, scheme := "", "http://"
+			if tt.want {
+				want, scheme = "max-age="+hstsMaxAge, "https://"
+			}
+			if got := rr.Header().Get("Strict-Transport-Security"); got != want {
+				t.Errorf("Strict-Transport-Security = %q, want %q", got, want)
+			}
+			// Share links follow the same rule.
+			if got := shareURL(req, "id"); !strings.HasPrefix(got, scheme) {
+				t.Errorf("shareURL() = %q, want the %s scheme", got, scheme)
+			}
+		})
+	}
+}
+
+func TestSecurityHeaders_NoStore(t *testing.T) {
+	r := newTestRouter(t)
+
+	do := func(method, target string, form url.Values) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		return rr
+	}
+
+	index := do("GET", "/", nil)
+	if got := index.Header().Get("Cache-Control"); got != "" {
+		t.Errorf("index: Cache-Control = %q, want none", got)
+	}
+
+	link := do("POST", "/create", url.Values{"inputText": {"cached?"}})
+	if link.Code != http.StatusOK {
+		t.Fatalf("create: got status %v want %v", link.Code, http.StatusOK)
+	}
+	m := regexp.MustCompile(`/get/([A-Za-z0-9]+)`).FindStringSubmatch(link.Body.String())
+	if m == nil {
+		t.Fatal("create: no share link in the page")
+	}
+
+	pages := map[string]*httptest.ResponseRecorder{
+		"link":   link,
+		"reveal": do("GET", "/get/"+m[1], nil),
+		"secret": do("POST", "/get/"+m[1], nil),
+	}
+	for name, rr := range pages {
+		if got := rr.Header().Get("Cache-Control"); got != "no-store" {
+			t.Errorf("%s: Cache-Control = %q, want no-store", name, got)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"log"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/danstis/go-read-burn/internal/store"
+	"github.com/gorilla/mux"
+)
+
+// Route names of the health endpoints, which are logged at debug level as
+// orchestrators poll them constantly.
+const (
+	routeHealthz = "healthz"
+	routeReadyz  = "readyz"
+)
+
+// probeKeyPrefix prefixes the keys of readiness probe records. Secret keys
+// are base62, so they can never collide with a probe.
+const probeKeyPrefix = "_probe_"
+
+// probeTimeout bounds the readiness probe write.
+const probeTimeout = 2 * time.Second
+
+// probeCacheTTL is how long the result of a readiness probe is reused, so
+// polling /readyz costs at most one probe write per period.
+const probeCacheTTL = 5 * time.Second
+
+// Rate limit of /readyz per client, generous enough for orchestrators.
+const (
+	readyzRateLimit = 120
+	readyzRateBurst = 20
+)
+
+// errProbeTimeout is reported when a readiness probe does not finish within
+// probeTimeout, which not every backend enforces itself.
+var errProbeTimeout = errors.New("readiness probe timed out")
+
+// storeReady caches the result of the readiness probe of the secret store.
+var storeReady storeProbe
+
+// serving is set once the server is accepting requests, and cleared when it
+// starts shutting down so load balancers stop sending traffic.
+var serving atomic.Bool
+
+// healthResponse is the body of /healthz and /readyz.
+type healthResponse struct {
+	Status  string            `json:"status"`
+	Version string            `json:"version"`
+	Commit  string            `json:"commit"`
+	Date    string            `json:"date"`
+	Checks  map[string]string `json:"checks,omitempty"`
+}
+
+func setupHealthRoutes(r *mux.Router) {
+	r.HandleFunc("/healthz", HealthzHandler).Methods("GET").Name(routeHealthz)
+	r.HandleFunc("/readyz", ReadyzHandler).Methods("GET").Name(routeReadyz)
+}
+
+// HealthzHandler reports that the process is alive.
+func HealthzHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, newHealthResponse("ok", nil))
+}
+
+// ReadyzHandler reports whether the server can serve secrets: it is not
+// shutting down, the templates are parsed and a record can be written to and
+// removed from the secret store.
+func ReadyzHandler(w http.ResponseWriter, r *http.Request) {
+	checks := map[string]string{"server": "ok", "templates": "ok", "store": "ok"}
+	ok := true
+	fail := func(check, reason string) {
+		checks[check] = reason
+		ok = false
+	}
+
+	if !serving.Load() {
+		fail("server", "not serving")
+	}
+	if templates == nil {
+		fail("templates", "not parsed")
+	}
+	if secretStore == nil {
+		fail("store", "not open")
+	} else if err := storeReady.check(r.Context(), secretStore); err != nil {
+		log.Printf("readiness probe failed: %v", err)
+		fail("store", "probe failed")
+	}
+
+	if !ok {
+		writeJSON(w, http.StatusServiceUnavailable, newHealthResponse("unavailable", checks))
+		return
+	}
+	writeJSON(w, http.StatusOK, newHealthResponse("ok", checks))
+}
+
+// newHealthResponse returns a health response with the build information.
+func newHealthResponse(status string, checks map[string]string) healthResponse {
+	return healthResponse{Status: status, Version: version, Commit: commit, Date: date, Checks: checks}
+}
+
+// storeProbe runs probeStore at most once per probeCacheTTL, sharing the
+// result between concurrent readiness checks.
+type storeProbe struct {
+	mu   sync.Mutex
+	st   store.SecretStore
+	last *probeRun
+}
+
+// probeRun is a single run of probeStore. Its fields are set before done is
+// closed.
+type probeRun struct {
+	done     chan struct{}
+	err      error
+	finished time.Time
+}
+
+// check returns the result of a recent probe of st, probing it again if the
+// last result is older than probeCacheTTL. It gives up after probeTimeout.
+func (p *storeProbe) check(ctx context.Context, st store.SecretStore) error {
+	p.mu.Lock()
+	run := p.last
+	if p.st != st || run == nil || run.stale() {
+		run = &probeRun{done: make(chan struct{})}
+		p.st, p.last = st, run
+		// The probe does not use the request's context, so a slow store is
+		// probed once rather than by every check that gives up on it.
+		go run.probe(st)
+	}
+	p.mu.Unlock()
+
+	timer := time.NewTimer(probeTimeout)
+	defer timer.Stop()
+	select {
+	case <-run.done:
+		return run.err
+	case <-timer.C:
+		return errProbeTimeout
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// stale reports whether the run finished more than probeCacheTTL ago.
+func (r *probeRun) stale() bool {
+	select {
+	case <-r.done:
+		return time.Since(r.finished) >= probeCacheTTL
+	default:
+		return false
+	}
+}
+
+// probe probes st and records the result.
+func (r *probeRun) probe(st store.SecretStore) {
+	r.err = probeStore(context.Background(), st)
+	r.finished = time.Now()
+	close(r.done)
+}
+
+// probeStore writes a short lived record to st and deletes it again. A probe
+// left behind by a failed delete expires and is removed by the reaper.
+func probeStore(ctx context.Context, st store.SecretStore) error {
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+
+	key := probeKeyPrefix + rand.Text()
+	rec := store.Record{Ciphertext: []byte("probe"), ExpiresAt: time.Now().Add(time.Minute).UTC(), RemainingViews: 1}
+	if err := st.Put(ctx, key, rec); err != nil {
+		return err
+	}
+	return st.Delete(ctx, key)
+}
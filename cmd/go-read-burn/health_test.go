@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/danstis/go-read-burn/internal/store"
+)
+
+// markServing marks the server as accepting requests for the rest of the
+// test.
+func markServing(t *testing.T) {
+	t.Helper()
+	serving.Store(true)
+	t.Cleanup(func() { serving.Store(false) })
+}
+
+func getHealth(t *testing.T, h http.Handler, target string) (int, healthResponse) {
+	t.Helper()
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest("GET", target, nil))
+	var resp healthResponse
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatalf("%s: invalid response: %v", target, err)
+	}
+	return rr.Code, resp
+}
+
+func TestHealthz(t *testing.T) {
+	r := newTestRouter(t)
+	markServing(t)
+	serving.Store(false)
+
+	code, resp := getHealth(t, r, "/healthz")
+	if code != http.StatusOK || resp.Status != "ok" {
+		t.Errorf("got status %v %q, want %v %q", code, resp.Status, http.StatusOK, "ok")
+	}
+	if resp.Version != version || resp.Commit != commit || resp.Date != date {
+		t.Errorf("build info = %q %q %q, want %q %q %q", resp.Version, resp.Commit, resp.Date, version, commit, date)
+	}
+}
+
+func TestReadyz(t *testing.T) {
+	r := newTestRouter(t)
+	markServing(t)
+
+	code, resp := getHealth(t, r, "/readyz")
+	if code != http.StatusOK || resp.Status != "ok" {
+		t.Fatalf("got status %v %q, want %v %q: %v", code, resp.Status, http.StatusOK, "ok", resp.Checks)
+	}
+	for _, check := range []string{"server", "templates", "store"} {
+		if resp.Checks[check] != "ok" {
+			t.Errorf("check %s = %q, want ok", check, resp.Checks[check])
+		}
+	}
+	if resp.Version != version {
+		t.Errorf("version = %q, want %q", resp.Version, version)
+	}
+	if n := countSecrets(t); n != 0 {
+		t.Errorf("%d probe records left in the store, want 0", n)
+	}
+}
+
+func TestReadyz_NotReady(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(t *testing.T)
+		check string
+	}{
+		{"shutting down", func(t *testing.T) { serving.Store(false) }, "server"},
+		{"templates not parsed", func(t *testing.T) { templates = nil }, "templates"},
+		{"store closed", func(t *testing.T) { secretStore.Close() }, "store"},
+		{"store not open", func(t *testing.T) {
+			st := secretStore
+			secretStore = nil
+			t.Cleanup(func() { secretStore = st })
+		}, "store"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestRouter(t)
+			markServing(t)
+			tt.setup(t)
+
+			code, resp := getHealth(t, r, "/readyz")
+			if code != http.StatusServiceUnavailable || resp.Status != "unavailable" {
+				t.Errorf("got status %v %q, want %v %q", code, resp.Status, http.StatusServiceUnavailable, "unavailable")
+			}
+			if resp.Checks[tt.check] == "ok" {
+				t.Errorf("check %s = ok: %v", tt.check, resp.Checks)
+			}
+		})
+	}
+}
+
+func TestReadyz_CachesProbe(t *testing.T) {
+	r := newTestRouter(t)
+	markServing(t)
+	counting := &countingStore{SecretStore: secretStore}
+	secretStore = counting
+
+	for range 5 {
+		if code, resp := getHealth(t, r, "/readyz"); code != http.StatusOK {
+			t.Fatalf("got status %v want %v: %v", code, http.StatusOK, resp.Checks)
+		}
+	}
+	if n := counting.puts.Load(); n != 1 {
+		t.Errorf("store probed %d times, want 1", n)
+	}
+}
+
+func TestReadyz_ProbeTimeout(t *testing.T) {
+	r := newTestRouter(t)
+	markServing(t)
+	stuck := &stuckStore{SecretStore: secretStore, release: make(chan struct{})}
+	t.Cleanup(func() { close(stuck.release) })
+	secretStore = stuck
+
+	start := time.Now()
+	code, resp := getHealth(t, r, "/readyz")
+	if code != http.StatusServiceUnavailable || resp.Checks["store"] == "ok" {
+		t.Errorf("got status %v %v, want %v with a failing store check", code, resp.Checks, http.StatusServiceUnavailable)
+	}
+	if elapsed := time.Since(start); elapsed > probeTimeout+time.Second {
+		t.Errorf("readiness check took %v, want about %v", elapsed, probeTimeout)
+	}
+}
+
+func TestReadyz_RateLimited(t *testing.T) {
+	if newRateLimits(Config{})[routeReadyz] == nil {
+		t.Error("/readyz is not rate limited")
+	}
+}
+
+// countingStore counts the records put into a store.
+type countingStore struct {
+	store.SecretStore
+	puts atomic.Int64
+}
+
+func (s *countingStore) Put(ctx context.Context, key string, rec store.Record) error {
+	s.puts.Add(1)
+	return s.SecretStore.Put(ctx, key, rec)
+}
+
+// stuckStore is a store whose writes hang until release is closed, ignoring
+// their context like bolt does.
+type stuckStore struct {
+	store.SecretStore
+	release chan struct{}
+}
+
+func (s *stuckStore) Put(ctx context.Context, key string, rec store.Record) error {
+	<-s.release
+	return s.SecretStore.Put(ctx, key, rec)
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/sync/semaphore"
+)
+
+// errBusy is returned when no key derivation slot became free within
+// Config.KDFQueueTimeout.
+var errBusy = errors.New("server is busy, please try again later")
+
+// derivationLimiter bounds the number of key derivations running at once. Each
+// scrypt derivation with the default parameters allocates about 128 MiB, so a
+// burst of requests could otherwise exhaust the memory of the container.
+// Requests beyond the limit queue in arrival order for up to timeout.
+type derivationLimiter struct {
+	sem     *semaphore.Weighted
+	timeout time.Duration
+	waiting atomic.Int64
+}
+
+// newDerivationLimiter returns a limiter allowing max concurrent derivations.
+func newDerivationLimiter(max int, timeout time.Duration) *derivationLimiter {
+	return &derivationLimiter{sem: semaphore.NewWeighted(int64(max)), timeout: timeout}
+}
+
+// acquire waits for a free slot, or returns errBusy if none becomes free
+// within the queue timeout. The returned function releases the slot.
+func (l *derivationLimiter) acquire(ctx context.Context) (release func(), err error) {
+	release = func() { l.sem.Release(1) }
+	if l.sem.TryAcquire(1) {
+		return release, nil
+	}
+
+	l.waiting.Add(1)
+	defer l.waiting.Add(-1)
+	ctx, cancel := context.WithTimeout(ctx, l.timeout)
+	defer cancel()
+	if err := l.sem.Acquire(ctx, 1); err != nil {
+		kdfRejected.Inc()
+		return nil, errBusy
+	}
+	return release, nil
+}
+
+// queueDepth returns the number of requests waiting for a slot.
+func (l *derivationLimiter) queueDepth() int64 {
+	return l.waiting.Load()
+}
+
+// setRetryAfter tells clients that were turned away to retry after d, rounded
+// up to whole seconds.
+func setRetryAfter(w http.ResponseWriter, d time.Duration) {
+	seconds := max(int(math.Ceil(d.Seconds())), 1)
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+}
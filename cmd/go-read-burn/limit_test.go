@@ -0,0 +1,143 @@
+package main
+
+import (
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// saturateDerivations replaces the package level limiter with one allowing a
+// single derivation, holds that slot for the rest of the test and returns the
+// limiter.
+func saturateDerivations(t *testing.T, timeout time.Duration) *derivationLimiter {
+	t.Helper()
+	prev := derivations
+	derivations = newDerivationLimiter(1, timeout)
+	release, err := derivations.acquire(t.Context())
+	if err != nil {
+		t.Fatalf("acquire() error: %v", err)
+	}
+	t.Cleanup(func() {
+		release()
+		derivations = prev
+	})
+	return derivations
+}
+
+func TestDerivationLimiter(t *testing.T) {
+	l := newDerivationLimiter(1, time.Second)
+	release, err := l.acquire(t.Context())
+	if err != nil {
+		t.Fatalf("acquire() error: %v", err)
+	}
+
+	acquired := make(chan error)
+	go func() {
+		release, err := l.acquire(t.Context())
+		if err == nil {
+			release()
+		}
+		acquired <- err
+	}()
+
+	deadline := time.Now().Add(time.Second)
+	for l.queueDepth() != 1 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if d := l.queueDepth(); d != 1 {
+		t.Fatalf("queueDepth() = %d, want 1", d)
+	}
+
+	release()
+	if err := <-acquired; err != nil {
+		t.Errorf("queued acquire() error: %v", err)
+	}
+	if d := l.queueDepth(); d != 0 {
+		t.Errorf("queueDepth() after acquiring = %d, want 0", d)
+	}
+}
+
+func TestDerivationLimiter_Timeout(t *testing.T) {
+	l := saturateDerivations(t, 10*time.Millisecond)
+
+	start := time.Now()
+	if _, err := l.acquire(t.Context()); err != errBusy {
+		t.Fatalf("acquire() error = %v, want %v", err, errBusy)
+	}
+	if elapsed := time.Since(start); elapsed < 10*time.Millisecond {
+		t.Errorf("acquire() gave up after %v, want at least the queue timeout", elapsed)
+	}
+	if d := l.queueDepth(); d != 0 {
+		t.Errorf("queueDepth() after timing out = %d, want 0", d)
+	}
+}
+
+func TestCreateHandler_Busy(t *testing.T) {
+	templates = template.Must(template.ParseFS(views, "views/*.html"))
+	setupTestConfig(t)
+	setupTestDB(t)
+	config.KDFQueueTimeout = 1500 * time.Millisecond
+	saturateDerivations(t, 10*time.Millisecond)
+
+	form := url.Values{"inputText": {"too busy"}, "ttl": {"1h"}}
+	req := httptest.NewRequest("POST", "/create", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr := httptest.NewRecorder()
+	CreateHandler(rr, req)
+
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusServiceUnavailable)
+	}
+	if got := rr.Header().Get("Retry-After"); got != "2" {
+		t.Errorf("Retry-After = %q, want %q", got, "2")
+	}
+	if !strings.Contains(rr.Body.String(), "The server is busy") {
+		t.Errorf("body does not explain the error: %s", rr.Body.String())
+	}
+	if n := countSecrets(t); n != 0 {
+		t.Errorf("%d secrets stored, want 0", n)
+	}
+}
+
+func TestAPI_Busy(t *testing.T) {
+	r := newTestRouter(t)
+	fullID, _, err := storeSecret(t.Context(), "waiting", secretOptions{TTL: time.Hour})
+	if err != nil {
+		t.Fatalf("storeSecret() error: %v", err)
+	}
+	saturateDerivations(t, 10*time.Millisecond)
+
+	rr := doAPIRequest(t, r, "POST", "/api/v1/secrets", `{"secret":"s"}`)
+	assertAPIError(t, rr, http.StatusServiceUnavailable, "server_busy")
+	if rr.Header().Get("Retry-After") == "" {
+		t.Error("create: Retry-After header not set")
+	}
+
+	rr = doAPIRequest(t, r, "POST", "/api/v1/secrets/"+fullID+"/reveal", "")
+	assertAPIError(t, rr, http.StatusServiceUnavailable, "server_busy")
+
+	// A request turned away must not burn the secret.
+	if _, err := lookupSecret(t.Context(), fullID); err != nil {
+		t.Errorf("lookupSecret() after a busy reveal error: %v", err)
+	}
+}
+
+func TestKDFMetrics(t *testing.T) {
+	rr := httptest.NewRecorder()
+	promhttp.Handler().ServeHTTP(rr, httptest.NewRequest("GET", "/metrics", nil))
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+	for _, name := range []string{"grb_kdf_queue_depth", "grb_kdf_rejected_total"} {
+		if !strings.Contains(rr.Body.String(), name) {
+			t.Errorf("metric %s not exported", name)
+		}
+	}
+}
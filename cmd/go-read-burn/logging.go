@@ -0,0 +1,132 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/danstis/go-read-burn/internal/crypto"
+	"github.com/gorilla/mux"
+)
+
+// redacted replaces secret IDs in logged paths.
+const redacted = "[REDACTED]"
+
+// logHashKey keys the hashes of secret keys in logged paths. It is generated
+// at startup, so requests for the same secret can be correlated within a
+// process, but a hash cannot be matched to its key.
+var logHashKey = []byte(rand.Text())
+
+// maxRequestIDLength is the longest X-Request-ID accepted from a client.
+const maxRequestIDLength = 64
+
+// setupLogger makes a JSON handler logging at level and above the default
+// logger, which the standard log package also writes through.
+func setupLogger(level string) error {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(level)); err != nil {
+		return fmt.Errorf("invalid log level %q", level)
+	}
+	slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: l})))
+	return nil
+}
+
+// accessLogMiddleware logs each request with its request ID, route, status and
+// latency. Secret IDs are redacted from the logged path, and the query string
+// is never logged.
+func accessLogMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		id := requestID(r)
+		w.Header().Set("X-Request-ID", id)
+
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+
+		level := slog.LevelInfo
+		switch {
+		case rec.status >= http.StatusInternalServerError:
+			level = slog.LevelError
+		case isHealthCheck(r):
+			level = slog.LevelDebug
+		}
+		slog.LogAttrs(r.Context(), level, "request",
+			slog.String("request_id", id),
+			slog.String("method", r.Method),
+			slog.String("route", routeLabel(r)),
+			slog.String("path", redactPath(r.URL.Path)),
+			slog.Int("status", rec.status),
+			slog.Duration("latency", time.Since(start)),
+			slog.String("client_ip", clientIP(r)),
+		)
+	})
+}
+
+// isHealthCheck reports whether r is for one of the health endpoints.
+func isHealthCheck(r *http.Request) bool {
+	if route := mux.CurrentRoute(r); route != nil {
+		return route.GetName() == routeHealthz || route.GetName() == routeReadyz
+	}
+	return false
+}
+
+// requestID returns the X-Request-ID of r if it is set to something safe to
+// log, or a new random ID.
+func requestID(r *http.Request) string {
+	id := r.Header.Get("X-Request-ID")
+	if id == "" || len(id) > maxRequestIDLength || strings.ContainsFunc(id, invalidRequestIDChar) {
+		return rand.Text()
+	}
+	return id
+}
+
+// invalidRequestIDChar reports whether c may not appear in a request ID.
+func invalidRequestIDChar(c rune) bool {
+	return !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.')
+}
+
+// redactPath removes secret IDs from a request path. The segment following
+// "get" or "secrets" is the ID in every route that takes one, and any other
+// segment long enough to be an ID is treated as one too. Even the key of an
+// ID is enough to destroy a passphrase protected secret with failed attempts,
+// so valid IDs are replaced by a keyed hash of their key and anything else is
+// replaced entirely.
+func redactPath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, seg := range segments {
+		afterIDPrefix := i > 0 && (segments[i-1] == "get" || segments[i-1] == "secrets")
+		if seg == "" || !afterIDPrefix && len(seg) < crypto.PasswordLength {
+			continue
+		}
+		segments[i] = redactID(seg)
+	}
+	return strings.Join(segments, "/")
+}
+
+// redactID returns a redaction marker for fullID, holding the keyHash of its
+// key if it is a valid ID.
+func redactID(fullID string) string {
+	id, err := crypto.ParseID(fullID)
+	if err != nil {
+		return redacted
+	}
+	return "[REDACTED:" + keyHash(id.Key) + "]"
+}
+
+// keyHash returns a short keyed hash of a secret key, which identifies the
+// secret in logs without revealing its key.
+func keyHash(key string) string {
+	mac := hmac.New(sha256.New, logHashKey)
+	mac.Write([]byte(key))
+	return hex.EncodeToString(mac.Sum(nil)[:8])
+}
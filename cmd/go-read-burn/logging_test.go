@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/danstis/go-read-burn/internal/crypto"
+)
+
+// captureLogs sends the default logger to a JSON buffer for the rest of the
+// test.
+func captureLogs(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	prev := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&buf, nil)))
+	t.Cleanup(func() { slog.SetDefault(prev) })
+	return &buf
+}
+
+func TestRedactPath(t *testing.T) {
+	id, err := crypto.GenerateID()
+	if err != nil {
+		t.Fatalf("GenerateID() error: %v", err)
+	}
+	v2 := id.String()
+	key := "[REDACTED:" + keyHash(id.Key) + "]"
+	legacy := strings.Repeat("k", 8) + strings.Repeat("p", 64)
+	legacyKey := "[REDACTED:" + keyHash("kkkkkkkk") + "]"
+
+	tests := []struct {
+		name string
+		path string
+		want string
+	}{
+		{"index", "/", "/"},
+		{"static", "/static/js/messageCount.js", "/static/js/messageCount.js"},
+		{"reveal", "/get/" + v2, "/get/" + key},
+		{"legacy", "/get/" + legacy, "/get/" + legacyKey},
+		{"api reveal", "/api/v1/secrets/" + v2 + "/reveal", "/api/v1/secrets/" + key + "/reveal"},
+		{"api create", "/api/v1/secrets", "/api/v1/secrets"},
+		{"malformed ID", "/get/" + v2[:79] + "!", "/get/[REDACTED]"},
+		{"short ID", "/get/abc", "/get/[REDACTED]"},
+		{"ID elsewhere", "/other/" + v2 + "/path", "/other/" + key + "/path"},
+		{"trailing slash", "/get/" + v2 + "/", "/get/" + key + "/"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := redactPath(tt.path); got != tt.want {
+				t.Errorf("redactPath() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("X-Request-ID", "abc-123")
+	if got := requestID(req); got != "abc-123" {
+		t.Errorf("requestID() = %q, want the client's ID", got)
+	}
+
+	for _, bad := range []string{"", "has space", "line\nbreak", strings.Repeat("a", maxRequestIDLength+1)} {
+		req.Header.Set("X-Request-ID", bad)
+		if got := requestID(req); got == bad || got == "" {
+			t.Errorf("requestID() with X-Request-ID %q = %q, want a new ID", bad, got)
+		}
+	}
+}
+
+func TestSetupLogger(t *testing.T) {
+	prev := slog.Default()
+	t.Cleanup(func() { slog.SetDefault(prev) })
+
+	for _, level := range []string{"debug", "info", "WARN", "error"} {
+		if err := setupLogger(level); err != nil {
+			t.Errorf("setupLogger(%q) error: %v", level, err)
+		}
+	}
+	if err := setupLogger("verbose"); err == nil {
+		t.Error("setupLogger() with an invalid level succeeded")
+	}
+}
+
+func TestAccessLog(t *testing.T) {
+	r := newTestRouter(t)
+	logs := captureLogs(t)
+
+	do := func(method, target, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := do("POST", "/api/v1/secrets", `{"secret":"logged?","passphrase":"pass"}`)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("create: got status %v want %v: %s", rr.Code, http.StatusCreated, rr.Body.String())
+	}
+	if rr.Header().Get("X-Request-ID") == "" {
+		t.Error("X-Request-ID header not set")
+	}
+	var resp createSecretResponse
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatalf("create: invalid response: %v", err)
+	}
+	fullID := resp.ID
+
+	do("GET", "/get/"+fullID, "")
+	do("POST", "/get/"+fullID+"?passphrase=pass", "")
+	do("POST", "/api/v1/secrets/"+fullID+"/reveal", `{"passphrase":"wrong"}`)
+	do("GET", "/get/"+fullID+"/unknown", "")
+	do("GET", "/get/"+fullID[:40]+"-"+fullID[41:], "")
+	do("POST", "/api/v1/secrets/"+withWrongPassword(t, fullID)+"/reveal", "")
+
+	output := logs.String()
+	for _, leak := range []string{fullID[1:9], fullID[9:40], fullID[41:], "passphrase=pass", "logged?"} {
+		if strings.Contains(output, leak) {
+			t.Errorf("log output contains %q:\n%s", leak, output)
+		}
+	}
+
+	var entries []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+		var entry map[string]any
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("log line is not JSON: %q", line)
+		}
+		if entry["msg"] == "request" {
+			entries = append(entries, entry)
+		}
+	}
+	if len(entries) != 7 {
+		t.Fatalf("got %d access log entries, want 7:\n%s", len(entries), output)
+	}
+
+	reveal := entries[1]
+	want := map[string]any{
+		"method": "GET",
+		"route":  "/get/{key}",
+		"path":   "/get/" + redactID(fullID),
+		"status": float64(http.StatusOK),
+	}
+	for k, v := range want {
+		if reveal[k] != v {
+			t.Errorf("reveal entry %s = %v, want %v", k, reveal[k], v)
+		}
+	}
+	for _, k := range []string{"request_id", "latency", "client_ip"} {
+		if _, ok := reveal[k]; !ok {
+			t.Errorf("reveal entry has no %s", k)
+		}
+	}
+	if notFound := entries[4]; notFound["status"] != float64(http.StatusNotFound) || notFound["route"] != "unmatched" {
+		t.Errorf("unknown path entry = %v, want a 404 for an unmatched route", notFound)
+	}
+}
@@ -3,18 +3,23 @@ package main
 import (
 	"context"
 	"embed"
+	"errors"
 	"fmt"
 	"html/template"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
-	"path"
+	"strconv"
+	"syscall"
 	"time"
 
-	"github.com/boltdb/bolt"
+	"github.com/danstis/go-read-burn/internal/crypto"
+	"github.com/danstis/go-read-burn/internal/store"
 	"github.com/gorilla/mux"
 	"github.com/kelseyhightower/envconfig"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 //go:embed all:views/*
@@ -24,33 +29,132 @@ var views embed.FS
 var static embed.FS
 
 var (
-	db        *bolt.DB
-	templates *template.Template
-	version   = "0.0.0-development"
-	commit    = "none"
-	date      = "unknown"
+	secretStore store.SecretStore
+	config      Config
+	kdfParams   = crypto.DefaultKDF
+	derivations = newDerivationLimiter(4, 10*time.Second)
+	templates   *template.Template
+	version     = "0.0.0-development"
+	commit      = "none"
+	date        = "unknown"
 )
 
 type Config struct {
-	DBPath     string `default:"db/secrets.db" split_words:"true"`
-	ListenPort string `default:"80" split_words:"true"`
-	ListenHost string `default:"0.0.0.0" split_words:"true"`
+	StoreBackend          string        `default:"bolt" split_words:"true"`
+	DBPath                string        `default:"db/secrets.db" split_words:"true"`
+	RedisURL              string        `default:"redis://localhost:6379/0" split_words:"true"`
+	DatabaseURL           string        `split_words:"true"`
+	ListenPort            string        `default:"80" split_words:"true"`
+	ListenHost            string        `default:"0.0.0.0" split_words:"true"`
+	DefaultTTL            time.Duration `default:"24h" split_words:"true"`
+	MaxTTL                time.Duration `default:"720h" split_words:"true"`
+	ReapInterval          time.Duration `default:"1m" split_words:"true"`
+	MaxPassphraseAttempts int           `default:"3" split_words:"true"`
+	MaxViews              int           `default:"10" split_words:"true"`
+	MaxSecretSize         int64         `default:"8000" split_words:"true"`
+	MaxFileSize           int64         `default:"10485760" split_words:"true"`
+	KDF                   string        `default:"scrypt" split_words:"true"`
+	ScryptN               int           `default:"131072" split_words:"true"`
+	ScryptR               int           `default:"8" split_words:"true"`
+	ScryptP               int           `default:"1" split_words:"true"`
+	Argon2Time            uint32        `default:"3" split_words:"true"`
+	Argon2Memory          uint32        `default:"65536" split_words:"true"`
+	Argon2Threads         uint8         `default:"4" split_words:"true"`
+	MaxConcurrentKDF      int           `default:"4" split_words:"true"`
+	KDFQueueTimeout       time.Duration `default:"10s" split_words:"true"`
+	CreateRateLimit       float64       `default:"10" split_words:"true"`
+	CreateRateBurst       int           `default:"20" split_words:"true"`
+	RevealRateLimit       float64       `default:"30" split_words:"true"`
+	RevealRateBurst       int           `default:"30" split_words:"true"`
+	TrustedProxies        []string      `split_words:"true"`
+	MetricsAddr           string        `split_words:"true"`
+	OTLPEndpoint          string        `envconfig:"OTLP_ENDPOINT"`
+	LogLevel              string        `default:"info" split_words:"true"`
+	ShutdownDelay         time.Duration `default:"5s" split_words:"true"`
+	TLSCertFile           string        `split_words:"true"`
+	TLSKeyFile            string        `split_words:"true"`
+	TLSMinVersion         string        `default:"1.2" split_words:"true"`
+	HTTPRedirectPort      string        `split_words:"true"`
+}
+
+// kdf returns the key derivation parameters new secrets are encrypted with.
+func (c Config) kdf() (crypto.KDFParams, error) {
+	k := crypto.KDFParams{Algorithm: c.KDF}
+	switch c.KDF {
+	case crypto.KDFScrypt:
+		k.N, k.R, k.P = c.ScryptN, c.ScryptR, c.ScryptP
+	case crypto.KDFArgon2id:
+		k.Time, k.Memory, k.Threads = c.Argon2Time, c.Argon2Memory, c.Argon2Threads
+	}
+	return k, k.Validate()
+}
+
+// ttlOption is an expiry choice offered on the index page.
+type ttlOption struct {
+	Label    string
+	Value    time.Duration
+	Selected bool
+}
+
+// ttlChoices are the expiry periods offered on the index page, before being
+// capped by Config.MaxTTL.
+var ttlChoices = []struct {
+	label string
+	value time.Duration
+}{
+	{"1 hour", time.Hour},
+	{"1 day", 24 * time.Hour},
+	{"7 days", 7 * 24 * time.Hour},
+	{"30 days", 30 * 24 * time.Hour},
 }
 
 // Main entry point for the app.
 func main() {
+	var err error
+	config, err = loadConfig()
+	if err != nil {
+		log.Fatalf("failed to load config: %v", err)
+	}
+	if err := setupLogger(config.LogLevel); err != nil {
+		log.Fatalf("failed to set up logging: %v", err)
+	}
 	log.Printf("Version %s - Commit: %s, Build Date: %s", version, commit, date)
 
-	config, err := loadConfig()
+	if config.MaxSecretSize < 1 {
+		log.Fatalf("GRB_MAX_SECRET_SIZE must be at least 1")
+	}
+
+	kdfParams, err = config.kdf()
 	if err != nil {
-		log.Fatalf("failed to load config: %v", err)
+		log.Fatalf("invalid key derivation settings: %v", err)
+	}
+	if config.MaxConcurrentKDF < 1 {
+		log.Fatalf("GRB_MAX_CONCURRENT_KDF must be at least 1")
 	}
+	derivations = newDerivationLimiter(config.MaxConcurrentKDF, config.KDFQueueTimeout)
 
-	db, err = openDB(config.DBPath)
+	if (config.CreateRateLimit > 0 && config.CreateRateBurst < 1) || (config.RevealRateLimit > 0 && config.RevealRateBurst < 1) {
+		log.Fatalf("rate limit bursts must be at least 1")
+	}
+	rateLimits = newRateLimits(config)
+	trustedProxies, err = parseTrustedProxies(config.TrustedProxies)
 	if err != nil {
-		log.Fatalf("failed to open DB: %v", err)
+		log.Fatalf("failed to parse GRB_TRUSTED_PROXIES: %v", err)
 	}
-	defer db.Close()
+
+	shutdownTelemetry := func(context.Context) error { return nil }
+	if config.OTLPEndpoint != "" {
+		shutdownTelemetry, err = setupTelemetry(context.Background(), config.OTLPEndpoint)
+		if err != nil {
+			log.Fatalf("failed to set up telemetry: %v", err)
+		}
+	}
+
+	secretStore, err = openStore(config)
+	if err != nil {
+		log.Fatalf("failed to open %s secret store: %v", config.StoreBackend, err)
+	}
+	defer secretStore.Close()
 
 	r := mux.NewRouter()
 	setupRoutes(r)
@@ -60,11 +164,34 @@ func main() {
 		log.Fatalf("failed to parse templates: %v", err)
 	}
 
+	if config.ReapInterval < 0 {
+		log.Fatalf("GRB_REAP_INTERVAL must not be negative")
+	}
+	rp := startReaper(secretStore, config.ReapInterval)
+
 	srv := createServer(config.ListenHost, config.ListenPort, r)
+	servers := []*http.Server{srv}
+	if config.TLSCertFile != "" || config.TLSKeyFile != "" {
+		srv.TLSConfig, err = setupTLS(config)
+		if err != nil {
+			log.Fatalf("failed to set up TLS: %v", err)
+		}
+		if config.HTTPRedirectPort != "" {
+			servers = append(servers, createRedirectServer(net.JoinHostPort(config.ListenHost, config.HTTPRedirectPort), config.ListenPort))
+		}
+	} else if config.HTTPRedirectPort != "" {
+		log.Fatalf("GRB_HTTP_REDIRECT_PORT requires GRB_TLS_CERT_FILE and GRB_TLS_KEY_FILE")
+	}
+	if config.MetricsAddr != "" {
+		servers = append(servers, createMetricsServer(config.MetricsAddr))
+	}
 
-	startServer(srv)
+	for _, s := range servers {
+		startServer(s)
+	}
+	serving.Store(true)
 
-	shutdownServer(srv, db)
+	shutdownServer(servers, secretStore, rp, shutdownTelemetry)
 }
 
 func loadConfig() (Config, error) {
@@ -76,25 +203,35 @@ func loadConfig() (Config, error) {
 	return config, nil
 }
 
-func openDB(dbPath string) (*bolt.DB, error) {
-	err := createDBDir(dbPath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create database directory: %w", err)
-	}
-	db, err := bolt.Open(dbPath, 0644, nil)
+// openStore opens the secret store backend selected by config, instrumented
+// for tracing.
+func openStore(config Config) (store.SecretStore, error) {
+	st, err := store.Open(store.Config{
+		Backend:     config.StoreBackend,
+		BoltPath:    config.DBPath,
+		RedisURL:    config.RedisURL,
+		DatabaseURL: config.DatabaseURL,
+	})
 	if err != nil {
 		return nil, err
 	}
-	return db, nil
+	return traceStore(st, config.StoreBackend), nil
 }
 
 func setupRoutes(r *mux.Router) {
 	r.HandleFunc("/", IndexHandler)
-	r.HandleFunc("/create", CreateHandler).Methods("POST")
-	r.HandleFunc("/get/{key}", SecretHandler)
+	r.HandleFunc("/create", CreateHandler).Methods("POST").Name(routeCreate)
+	r.HandleFunc("/get/{key}", RevealHandler).Methods("GET").Name(routeReveal)
+	r.HandleFunc("/get/{key}", SecretHandler).Methods("POST").Name(routeSecret)
+	setupAPIRoutes(r)
+	setupHealthRoutes(r)
+	if config.MetricsAddr == "" {
+		r.Handle("/metrics", promhttp.Handler()).Methods("GET")
+	}
 	s := http.StripPrefix("/static/", http.FileServer(http.FS(static)))
 	r.PathPrefix("/static/").Handler(s)
-	http.Handle("/", r)
+	r.Use(accessLogMiddleware, securityHeadersMiddleware, tracingMiddleware, metricsMiddleware, rateLimitMiddleware)
+	r.NotFoundHandler = accessLogMiddleware(securityHeadersMiddleware(http.NotFoundHandler()))
 }
 
 func parseTemplates() (*template.Template, error) {
@@ -115,53 +252,347 @@ func createServer(listenHost, listenPort string, r *mux.Router) *http.Server {
 	return srv
 }
 
+// startServer serves srv in the background, over TLS if srv.TLSConfig is set.
 func startServer(srv *http.Server) {
 	go func() {
-		log.Printf("Started server listing on %s", srv.Addr)
-		if err := srv.ListenAndServe(); err != nil {
+		var err error
+		if srv.TLSConfig != nil {
+			log.Printf("Started TLS server listing on %s", srv.Addr)
+			err = srv.ListenAndServeTLS("", "")
+		} else {
+			log.Printf("Started server listing on %s", srv.Addr)
+			err = srv.ListenAndServe()
+		}
+		if err != nil {
 			log.Println(err)
 		}
 	}()
 }
 
-func shutdownServer(srv *http.Server, db *bolt.DB) {
+// shutdownServer waits for an interrupt or termination signal, then drains
+// and stops servers, the reaper, the store and telemetry export.
+func shutdownServer(servers []*http.Server, st store.SecretStore, rp *reaper, shutdownTelemetry func(context.Context) error) {
 	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
 	<-c
 
+	// Fail readiness checks first, so load balancers stop sending new
+	// requests before the listener is closed.
+	log.Println("shutting down")
+	serving.Store(false)
+	time.Sleep(config.ShutdownDelay)
+
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
-	log.Println("shutting down")
+	for _, srv := range servers {
+		if err := srv.Shutdown(ctx); err != nil {
+			log.Println(err)
+		}
+	}
+
+	rp.Stop()
 
-	if err := srv.Shutdown(ctx); err != nil {
+	err := st.Close()
+	if err != nil {
 		log.Println(err)
 	}
 
-	err := db.Close()
-	if err != nil {
+	if err := shutdownTelemetry(ctx); err != nil {
 		log.Println(err)
 	}
 
 	os.Exit(0)
 }
 
-func createDBDir(p string) error {
-	dir := path.Dir(p)
-	return os.MkdirAll(dir, os.ModePerm)
-}
-
 func IndexHandler(w http.ResponseWriter, r *http.Request) {
-	if err := templates.ExecuteTemplate(w, "index.html", nil); err != nil {
+	data := map[string]interface{}{
+		"TTLOptions":    ttlOptions(),
+		"MaxViews":      config.MaxViews,
+		"MaxSecretSize": config.MaxSecretSize,
+		"MaxFileSize":   formatSize(config.MaxFileSize),
+		"Nonce":         cspNonce(r),
+	}
+	if err := templates.ExecuteTemplate(w, "index.html", data); err != nil {
 		http.Error(w, "error generating json: "+err.Error(), 500)
 		return
 	}
 }
 
+// CreateHandler encrypts the submitted secret or file, stores the ciphertext
+// and renders the link that can be used to retrieve it. When clientEncrypted
+// is set, inputText holds ciphertext produced in the browser and the
+// decryption key is kept in the URL fragment, which is never sent to the
+// server.
 func CreateHandler(w http.ResponseWriter, r *http.Request) {
-	fmt.Fprintf(w, "Create")
+	file, err := parseCreateForm(w, r)
+	if err != nil {
+		renderFormError(w, err)
+		return
+	}
+
+	plaintext := r.FormValue("inputText")
+	switch {
+	case plaintext == "" && file == nil:
+		renderError(w, http.StatusBadRequest, "Please enter a secret to share.")
+		return
+	case plaintext != "" && file != nil:
+		renderError(w, http.StatusBadRequest, "Please share either a secret or a file, not both.")
+		return
+	}
+
+	clientEncrypted := r.FormValue("clientEncrypted") == "true"
+	if clientEncrypted && file != nil {
+		renderError(w, http.StatusBadRequest, "Browser encryption is not supported for files.")
+		return
+	}
+	if clientEncrypted && !crypto.ValidateClientCiphertext(plaintext) {
+		renderError(w, http.StatusBadRequest, "The encrypted secret is malformed.")
+		return
+	}
+	if secretTooLarge(plaintext, clientEncrypted) {
+		renderFormError(w, errSecretTooLarge)
+		return
+	}
+
+	ttl, err := parseTTL(r.FormValue("ttl"))
+	if err != nil {
+		renderError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	views, err := parseViews(r.FormValue("views"))
+	if err != nil {
+		renderError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	opts := secretOptions{
+		TTL:             ttl,
+		ClientEncrypted: clientEncrypted,
+		Passphrase:      r.FormValue("passphrase"),
+		Views:           views,
+	}
+	var fullID string
+	var expiresAt time.Time
+	if file != nil {
+		fullID, expiresAt, err = storeFile(r.Context(), *file, opts)
+	} else {
+		fullID, expiresAt, err = storeSecret(r.Context(), plaintext, opts)
+	}
+	if errors.Is(err, errBusy) {
+		setRetryAfter(w, config.KDFQueueTimeout)
+		renderError(w, http.StatusServiceUnavailable, "The server is busy, please try again in a moment.")
+		return
+	}
+	if err != nil {
+		log.Printf("failed to store secret: %v", err)
+		renderError(w, http.StatusInternalServerError, "Unable to store the secret, please try again.")
+		return
+	}
+
+	data := map[string]interface{}{
+		"ShareURL":        shareURL(r, fullID),
+		"ExpiresAt":       expiresAt.Format(time.RFC1123),
+		"ClientEncrypted": clientEncrypted,
+		"Passphrase":      r.FormValue("passphrase") != "",
+		"Views":           views,
+		"File":            file != nil,
+		"Nonce":           cspNonce(r),
+	}
+	if err := templates.ExecuteTemplate(w, "link.html", data); err != nil {
+		http.Error(w, "error generating page: "+err.Error(), 500)
+		return
+	}
 }
 
+// RevealHandler renders a confirmation page for the secret with the given ID.
+// It does not read or burn the secret, so link previewers that fetch the URL
+// with a GET leave it intact; the secret is only revealed by the POST made when
+// the recipient confirms.
+func RevealHandler(w http.ResponseWriter, r *http.Request) {
+	fullID := mux.Vars(r)["key"]
+	info, err := lookupSecret(r.Context(), fullID)
+	switch {
+	case errors.Is(err, crypto.ErrInvalidIDLength), errors.Is(err, crypto.ErrInvalidIDCharacters),
+		errors.Is(err, crypto.ErrUnsupportedIDVersion), errors.Is(err, crypto.ErrInvalidIDEncoding):
+		renderError(w, http.StatusBadRequest, "The secret link is invalid.")
+		return
+	case errors.Is(err, store.ErrNotFound):
+		renderError(w, http.StatusNotFound, "This secret does not exist or has already been viewed.")
+		return
+	case err != nil:
+		log.Printf("failed to look up secret: %v", err)
+		renderError(w, http.StatusInternalServerError, "Unable to retrieve the secret, please try again.")
+		return
+	}
+
+	renderReveal(w, r, http.StatusOK, fullID, info, "")
+}
+
+// SecretHandler decrypts and displays the secret for the given ID, removing it
+// from the DB once it has been viewed as many times as its creator allowed.
+// File attachments are served as a download instead. Client encrypted secrets are
+// rendered as ciphertext for the browser to decrypt with the key in the URL
+// fragment.
+//
+// Passphrase protected secrets that are submitted with a missing or wrong
+// passphrase re-render the confirmation page so the recipient can try again.
 func SecretHandler(w http.ResponseWriter, r *http.Request) {
-	fmt.Fprintf(w, "Get")
+	fullID := mux.Vars(r)["key"]
+	sec, err := burnSecret(r.Context(), fullID, r.FormValue("passphrase"))
+	var wrongPassphrase *wrongPassphraseError
+	switch {
+	case errors.Is(err, crypto.ErrInvalidIDLength), errors.Is(err, crypto.ErrInvalidIDCharacters),
+		errors.Is(err, crypto.ErrUnsupportedIDVersion), errors.Is(err, crypto.ErrInvalidIDEncoding):
+		renderError(w, http.StatusBadRequest, "The secret link is invalid.")
+		return
+	case errors.Is(err, errPassphraseRequired):
+		renderReveal(w, r, http.StatusForbidden, fullID, secretInfo{Passphrase: true}, "Please enter the passphrase.")
+		return
+	case errors.As(err, &wrongPassphrase):
+		msg := "The passphrase is incorrect."
+		if wrongPassphrase.Remaining > 0 {
+			msg = fmt.Sprintf("The passphrase is incorrect, %d attempt(s) remaining before the secret is destroyed.", wrongPassphrase.Remaining)
+		}
+		renderReveal(w, r, http.StatusForbidden, fullID, secretInfo{Passphrase: true}, msg)
+		return
+	case errors.Is(err, errTooManyAttempts):
+		renderError(w, http.StatusGone, "Too many incorrect passphrase attempts, the secret has been destroyed.")
+		return
+	case errors.Is(err, errBusy):
+		setRetryAfter(w, config.KDFQueueTimeout)
+		renderError(w, http.StatusServiceUnavailable, "The server is busy, please try again in a moment.")
+		return
+	case errors.Is(err, store.ErrNotFound), errors.Is(err, crypto.ErrDecryptionFailed):
+		renderError(w, http.StatusNotFound, "This secret does not exist or has already been viewed.")
+		return
+	case err != nil:
+		log.Printf("failed to retrieve secret: %v", err)
+		renderError(w, http.StatusInternalServerError, "Unable to retrieve the secret, please try again.")
+		return
+	}
+
+	if sec.File != nil {
+		serveFile(w, sec.File)
+		return
+	}
+
+	data := map[string]interface{}{
+		"Secret":          sec.Plaintext,
+		"ClientEncrypted": sec.ClientEncrypted,
+		"RemainingViews":  sec.RemainingViews,
+		"Nonce":           cspNonce(r),
+	}
+	if err := templates.ExecuteTemplate(w, "secret.html", data); err != nil {
+		http.Error(w, "error generating page: "+err.Error(), 500)
+		return
+	}
+}
+
+// ttlOptions returns the expiry choices for the index page that do not exceed
+// Config.MaxTTL, with the default TTL selected.
+func ttlOptions() []ttlOption {
+	var opts []ttlOption
+	for _, c := range ttlChoices {
+		if c.value > config.MaxTTL {
+			break
+		}
+		opts = append(opts, ttlOption{Label: c.label, Value: c.value, Selected: c.value == config.DefaultTTL})
+	}
+	if len(opts) == 0 {
+		opts = append(opts, ttlOption{Label: config.MaxTTL.String(), Value: config.MaxTTL, Selected: true})
+	}
+	return opts
+}
+
+// parseTTL parses the requested time to live of a secret. An empty value
+// selects Config.DefaultTTL, and no TTL may exceed Config.MaxTTL.
+func parseTTL(value string) (time.Duration, error) {
+	if value == "" {
+		if config.DefaultTTL > config.MaxTTL {
+			return config.MaxTTL, nil
+		}
+		return config.DefaultTTL, nil
+	}
+	ttl, err := time.ParseDuration(value)
+	if err != nil || ttl <= 0 {
+		return 0, fmt.Errorf("invalid expiry %q", value)
+	}
+	if ttl > config.MaxTTL {
+		return 0, fmt.Errorf("expiry may not be longer than %s", config.MaxTTL)
+	}
+	return ttl, nil
+}
+
+// parseViews parses the requested number of times a secret may be viewed. An
+// empty value allows a single view, and no more than Config.MaxViews are
+// allowed.
+func parseViews(value string) (int, error) {
+	if value == "" {
+		return 1, nil
+	}
+	views, err := strconv.Atoi(value)
+	if err != nil || views < 1 {
+		return 0, fmt.Errorf("invalid number of views %q", value)
+	}
+	if views > config.MaxViews {
+		return 0, fmt.Errorf("a secret may not be viewed more than %d times", config.MaxViews)
+	}
+	return views, nil
+}
+
+// shareURL builds the absolute URL for retrieving the secret with the given ID,
+// based on the host the request was made to.
+func shareURL(r *http.Request, fullID string) string {
+	scheme := "http"
+	if isHTTPS(r) {
+		scheme = "https"
+	}
+	return fmt.Sprintf("%s://%s/get/%s", scheme, r.Host, fullID)
+}
+
+// renderFormError renders the error page for an error parsing a create form
+// or its uploaded file.
+func renderFormError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errSecretTooLarge):
+		renderError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("The secret may not be longer than %d bytes.", config.MaxSecretSize))
+	case errors.Is(err, errFileTooLarge):
+		renderError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("The file may not be larger than %s.", formatSize(config.MaxFileSize)))
+	case errors.Is(err, crypto.ErrEmptyPlaintext):
+		renderError(w, http.StatusBadRequest, "The file is empty.")
+	default:
+		renderError(w, http.StatusBadRequest, "Unable to read the submitted form.")
+	}
+}
+
+// renderReveal renders the confirmation page for the secret with the given ID,
+// prompting for a passphrase if one is required.
+func renderReveal(w http.ResponseWriter, r *http.Request, status int, fullID string, info secretInfo, message string) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	data := map[string]interface{}{
+		"ID":             fullID,
+		"Passphrase":     info.Passphrase,
+		"RemainingViews": info.RemainingViews,
+		"File":           info.File,
+		"Error":          message,
+		"Nonce":          cspNonce(r),
+	}
+	if err := templates.ExecuteTemplate(w, "reveal.html", data); err != nil {
+		log.Printf("failed to render reveal page: %v", err)
+	}
+}
+
+// renderError renders the error page with the given status code and message.
+func renderError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	data := map[string]interface{}{
+		"Error": message,
+	}
+	if err := templates.ExecuteTemplate(w, "error.html", data); err != nil {
+		log.Printf("failed to render error page: %v", err)
+	}
 }
@@ -2,44 +2,131 @@ package main
 
 import (
 	"bytes"
+	"encoding/base64"
 	"html/template"
 	"net/http"
 	"net/http/httptest"
-	"os"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/danstis/go-read-burn/internal/crypto"
+	"github.com/danstis/go-read-burn/internal/store"
+	"github.com/gorilla/mux"
 )
 
-func TestCreateDBDir(t *testing.T) {
-	// Create a temporary directory for testing
-	tempDir, err := os.MkdirTemp("", "test")
+// testKDF is a cheap key derivation for tests. TestBurnSecret_ConcurrentKDF
+// keeps using crypto.DefaultKDF.
+var testKDF = crypto.KDFParams{Algorithm: crypto.KDFScrypt, N: 1024, R: 8, P: 1}
+
+// setupTestConfig loads the default config into the package level config and
+// derives keys with testKDF.
+func setupTestConfig(t *testing.T) {
+	t.Helper()
+	var err error
+	config, err = loadConfig()
 	if err != nil {
-		t.Fatalf("Failed to create temp directory: %v", err)
+		t.Fatalf("Failed to load config: %v", err)
 	}
-	defer os.RemoveAll(tempDir)
+	kdfParams = testKDF
+}
+
+// newTestRouter sets up the templates, the default config and a temporary
+// store, and returns a router serving every route.
+func newTestRouter(t *testing.T) *mux.Router {
+	t.Helper()
+	templates = template.Must(template.ParseFS(views, "views/*.html"))
+	setupTestConfig(t)
+	setupTestDB(t)
+	r := mux.NewRouter()
+	setupRoutes(r)
+	return r
+}
 
-	// Test case: Directory does not exist
-	dbPath := tempDir + "/db/secrets.db"
-	err = createDBDir(dbPath)
+// setupTestDB opens a temporary bolt store and assigns it to the package level
+// secretStore.
+func setupTestDB(t *testing.T) {
+	t.Helper()
+	var err error
+	secretStore, err = store.OpenBolt(filepath.Join(t.TempDir(), "db", "secrets.db"))
 	if err != nil {
-		t.Errorf("Failed to create directory: %v", err)
+		t.Fatalf("Failed to open DB: %v", err)
 	}
+	t.Cleanup(func() { secretStore.Close() })
+}
 
-	// Check if directory was created
-	_, err = os.Stat(tempDir + "/db")
-	if os.IsNotExist(err) {
-		t.Errorf("Directory was not created")
+// storedRecord returns the record stored for the secret with the given ID.
+func storedRecord(t *testing.T, fullID string) store.Record {
+	t.Helper()
+	id, err := crypto.ParseID(fullID)
+	if err != nil {
+		t.Fatalf("invalid ID %q: %v", fullID, err)
+	}
+	rec, err := secretStore.Get(t.Context(), id.Key)
+	if err != nil {
+		t.Fatalf("no secret stored for key %q: %v", id.Key, err)
 	}
+	return rec
+}
 
-	// Test case: Directory already exists
-	err = createDBDir(dbPath)
+// withWrongPassword returns fullID with its password replaced, so it locates
+// the same secret but cannot decrypt it.
+func withWrongPassword(t *testing.T, fullID string) string {
+	t.Helper()
+	id, err := crypto.ParseID(fullID)
 	if err != nil {
-		t.Errorf("Failed when directory already exists: %v", err)
+		t.Fatalf("invalid ID %q: %v", fullID, err)
+	}
+	id.Password = strings.Repeat("x", crypto.PasswordLength)
+	return id.String()
+}
+
+func TestOpenStore(t *testing.T) {
+	for _, backend := range []string{store.BackendBolt, store.BackendMemory} {
+		st, err := openStore(Config{StoreBackend: backend, DBPath: filepath.Join(t.TempDir(), "db", "secrets.db")})
+		if err != nil {
+			t.Errorf("openStore(%q) error: %v", backend, err)
+			continue
+		}
+		st.Close()
+	}
+
+	if _, err := openStore(Config{StoreBackend: "floppy"}); err == nil {
+		t.Error("openStore() with an unknown backend succeeded")
+	}
+}
+
+func TestConfigKDF(t *testing.T) {
+	setupTestConfig(t)
+	if got, err := config.kdf(); err != nil || got != crypto.DefaultKDF {
+		t.Errorf("kdf() of the default config = %+v, %v, want %+v", got, err, crypto.DefaultKDF)
+	}
+
+	c := config
+	c.KDF = crypto.KDFArgon2id
+	want := crypto.KDFParams{Algorithm: crypto.KDFArgon2id, Time: 3, Memory: 65536, Threads: 4}
+	if got, err := c.kdf(); err != nil || got != want {
+		t.Errorf("kdf() with argon2id = %+v, %v, want %+v", got, err, want)
+	}
+
+	c.KDF = "md5"
+	if _, err := c.kdf(); err == nil {
+		t.Error("kdf() with an unknown algorithm succeeded")
+	}
+	c.KDF = crypto.KDFScrypt
+	c.ScryptN = 1000
+	if _, err := c.kdf(); err == nil {
+		t.Error("kdf() with an invalid scrypt N succeeded")
 	}
 }
 
 func TestIndexHandler(t *testing.T) {
 	// Initialize templates
 	templates = template.Must(template.ParseFS(views, "views/*.html"))
+	setupTestConfig(t)
 
 	req, err := http.NewRequest("GET", "/", nil)
 	if err != nil {
@@ -58,7 +145,13 @@ func TestIndexHandler(t *testing.T) {
 
 	// Execute template to get expected HTML content
 	var index bytes.Buffer
-	if err := templates.ExecuteTemplate(&index, "index.html", nil); err != nil {
+	data := map[string]interface{}{
+		"TTLOptions":    ttlOptions(),
+		"MaxViews":      config.MaxViews,
+		"MaxSecretSize": config.MaxSecretSize,
+		"MaxFileSize":   formatSize(config.MaxFileSize),
+	}
+	if err := templates.ExecuteTemplate(&index, "index.html", data); err != nil {
 		t.Fatal(err)
 	}
 
@@ -69,6 +162,394 @@ func TestIndexHandler(t *testing.T) {
 	}
 }
 
+func TestCreateHandler(t *testing.T) {
+	templates = template.Must(template.ParseFS(views, "views/*.html"))
+	setupTestConfig(t)
+	setupTestDB(t)
+
+	form := url.Values{"inputText": {"my super secret"}, "ttl": {"1h"}}
+	req := httptest.NewRequest("POST", "http://example.com/create", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	rr := httptest.NewRecorder()
+	CreateHandler(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+
+	re := regexp.MustCompile(`value="http://example\.com/get/([0-9a-zA-Z]+)"`)
+	m := re.FindStringSubmatch(rr.Body.String())
+	if m == nil {
+		t.Fatalf("share URL not found in body: %s", rr.Body.String())
+	}
+
+	id, err := crypto.ParseID(m[1])
+	if err != nil {
+		t.Fatalf("share URL contains invalid ID: %v", err)
+	}
+
+	rec := storedRecord(t, m[1])
+	if ttl := time.Until(rec.ExpiresAt); ttl <= 59*time.Minute || ttl > time.Hour {
+		t.Errorf("secret expires in %v, want 1h", ttl)
+	}
+
+	plaintext, err := id.Decrypt(rec.Ciphertext, "", kdfParams)
+	if err != nil {
+		t.Fatalf("failed to decrypt stored secret: %v", err)
+	}
+	if string(plaintext) != "my super secret" {
+		t.Errorf("decrypted secret = %q, want %q", plaintext, "my super secret")
+	}
+}
+
+func TestCreateHandler_BadInput(t *testing.T) {
+	templates = template.Must(template.ParseFS(views, "views/*.html"))
+	setupTestConfig(t)
+	setupTestDB(t)
+
+	tests := []struct {
+		name    string
+		form    url.Values
+		wantMsg string
+	}{
+		{
+			name:    "empty secret",
+			form:    url.Values{"inputText": {""}},
+			wantMsg: "Please enter a secret",
+		},
+		{
+			name:    "invalid ttl",
+			form:    url.Values{"inputText": {"secret"}, "ttl": {"soon"}},
+			wantMsg: "invalid expiry",
+		},
+		{
+			name:    "ttl above maximum",
+			form:    url.Values{"inputText": {"secret"}, "ttl": {"8760h"}},
+			wantMsg: "expiry may not be longer than",
+		},
+		{
+			name:    "malformed client ciphertext",
+			form:    url.Values{"inputText": {"not encrypted"}, "clientEncrypted": {"true"}},
+			wantMsg: "The encrypted secret is malformed.",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/create", strings.NewReader(tt.form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+			rr := httptest.NewRecorder()
+			CreateHandler(rr, req)
+
+			if rr.Code != http.StatusBadRequest {
+				t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusBadRequest)
+			}
+			if !strings.Contains(rr.Body.String(), tt.wantMsg) {
+				t.Errorf("expected error %q, got: %s", tt.wantMsg, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestCreateHandler_SecretTooLarge(t *testing.T) {
+	templates = template.Must(template.ParseFS(views, "views/*.html"))
+	setupTestConfig(t)
+	setupTestDB(t)
+	config.MaxSecretSize = 16
+
+	clientCiphertext := func(n int) string {
+		return base64.StdEncoding.EncodeToString(make([]byte, 12+16+n))
+	}
+	tests := []struct {
+		name       string
+		form       url.Values
+		wantStatus int
+	}{
+		{"at limit", url.Values{"inputText": {strings.Repeat("a", 16)}}, http.StatusOK},
+		{"too long", url.Values{"inputText": {strings.Repeat("a", 17)}}, http.StatusRequestEntityTooLarge},
+		{"multibyte", url.Values{"inputText": {strings.Repeat("é", 9)}}, http.StatusRequestEntityTooLarge},
+		{"body too large", url.Values{"inputText": {strings.Repeat("a", int(maxSecretBodySize()))}}, http.StatusRequestEntityTooLarge},
+		{"client encrypted at limit", url.Values{"inputText": {clientCiphertext(16)}, "clientEncrypted": {"true"}}, http.StatusOK},
+		{"client encrypted too long", url.Values{"inputText": {clientCiphertext(17)}, "clientEncrypted": {"true"}}, http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/create", strings.NewReader(tt.form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			rr := httptest.NewRecorder()
+			CreateHandler(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, tt.wantStatus)
+			}
+			if tt.wantStatus == http.StatusRequestEntityTooLarge && !strings.Contains(rr.Body.String(), "may not be longer than 16 bytes") {
+				t.Errorf("body does not explain the error: %s", rr.Body.String())
+			}
+		})
+	}
+
+	if n := countSecrets(t); n != 2 {
+		t.Errorf("%d secrets stored, want 2", n)
+	}
+}
+
+func TestClientEncryptedSecret(t *testing.T) {
+	templates = template.Must(template.ParseFS(views, "views/*.html"))
+	setupTestConfig(t)
+	setupTestDB(t)
+
+	ciphertext := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte("A"), 48))
+	form := url.Values{"inputText": {ciphertext}, "clientEncrypted": {"true"}}
+	req := httptest.NewRequest("POST", "http://example.com/create", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr := httptest.NewRecorder()
+	CreateHandler(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("create: got status %v want %v", rr.Code, http.StatusOK)
+	}
+	m := regexp.MustCompile(`value="http://example\.com/get/([0-9a-zA-Z]+)"`).FindStringSubmatch(rr.Body.String())
+	if m == nil {
+		t.Fatalf("share URL not found in body: %s", rr.Body.String())
+	}
+	if !strings.Contains(rr.Body.String(), `id="missingKey"`) {
+		t.Error("link page is missing the browser encryption key handling")
+	}
+
+	req = httptest.NewRequest("POST", "/get/"+m[1], nil)
+	req = mux.SetURLVars(req, map[string]string{"key": m[1]})
+	rr = httptest.NewRecorder()
+	SecretHandler(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("reveal: got status %v want %v", rr.Code, http.StatusOK)
+	}
+	if !strings.Contains(rr.Body.String(), `data-ciphertext="`+ciphertext+`"`) {
+		t.Errorf("secret page does not contain the ciphertext for the browser: %s", rr.Body.String())
+	}
+	if !strings.Contains(rr.Body.String(), "/static/js/clientCrypto.js") {
+		t.Error("secret page does not load the browser decryption script")
+	}
+}
+
+func TestSecretHandler_Passphrase(t *testing.T) {
+	templates = template.Must(template.ParseFS(views, "views/*.html"))
+	setupTestConfig(t)
+	setupTestDB(t)
+
+	fullID, _, err := storeSecret(t.Context(), "behind a passphrase", secretOptions{TTL: time.Hour, Passphrase: "letmein"})
+	if err != nil {
+		t.Fatalf("storeSecret() error: %v", err)
+	}
+
+	req := httptest.NewRequest("GET", "/get/"+fullID, nil)
+	req = mux.SetURLVars(req, map[string]string{"key": fullID})
+	rr := httptest.NewRecorder()
+	RevealHandler(rr, req)
+	if !strings.Contains(rr.Body.String(), `name="passphrase"`) {
+		t.Errorf("reveal page does not ask for the passphrase: %s", rr.Body.String())
+	}
+
+	post := func(passphrase string) *httptest.ResponseRecorder {
+		form := url.Values{"passphrase": {passphrase}}
+		req := httptest.NewRequest("POST", "/get/"+fullID, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req = mux.SetURLVars(req, map[string]string{"key": fullID})
+		rr := httptest.NewRecorder()
+		SecretHandler(rr, req)
+		return rr
+	}
+
+	rr = post("guess")
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("wrong passphrase: got status %v want %v", rr.Code, http.StatusForbidden)
+	}
+	if !strings.Contains(rr.Body.String(), "2 attempt(s) remaining") || !strings.Contains(rr.Body.String(), `name="passphrase"`) {
+		t.Errorf("wrong passphrase: page does not prompt again: %s", rr.Body.String())
+	}
+
+	rr = post("letmein")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("correct passphrase: got status %v want %v", rr.Code, http.StatusOK)
+	}
+	if !strings.Contains(rr.Body.String(), "behind a passphrase") {
+		t.Errorf("correct passphrase: secret not found in body: %s", rr.Body.String())
+	}
+}
+
+func TestSecretHandler_MultipleViews(t *testing.T) {
+	templates = template.Must(template.ParseFS(views, "views/*.html"))
+	setupTestConfig(t)
+	setupTestDB(t)
+
+	form := url.Values{"inputText": {"for the team"}, "views": {"2"}}
+	req := httptest.NewRequest("POST", "http://example.com/create", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr := httptest.NewRecorder()
+	CreateHandler(rr, req)
+
+	if !strings.Contains(rr.Body.String(), "It can be viewed 2 times") {
+		t.Errorf("link page does not mention the number of views: %s", rr.Body.String())
+	}
+	m := regexp.MustCompile(`value="http://example\.com/get/([0-9a-zA-Z]+)"`).FindStringSubmatch(rr.Body.String())
+	if m == nil {
+		t.Fatalf("share URL not found in body: %s", rr.Body.String())
+	}
+
+	get := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/get/"+m[1], nil)
+		req = mux.SetURLVars(req, map[string]string{"key": m[1]})
+		rr := httptest.NewRecorder()
+		SecretHandler(rr, req)
+		return rr
+	}
+
+	rr = get()
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "can be viewed 1 more time(s)") {
+		t.Errorf("first view: got status %v, body: %s", rr.Code, rr.Body.String())
+	}
+	rr = get()
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "has been destroyed") {
+		t.Errorf("second view: got status %v, body: %s", rr.Code, rr.Body.String())
+	}
+	if rr = get(); rr.Code != http.StatusNotFound {
+		t.Errorf("third view: got status %v want %v", rr.Code, http.StatusNotFound)
+	}
+}
+
+func TestParseViews(t *testing.T) {
+	setupTestConfig(t)
+	config.MaxViews = 5
+
+	tests := []struct {
+		value   string
+		want    int
+		wantErr bool
+	}{
+		{"", 1, false},
+		{"1", 1, false},
+		{"5", 5, false},
+		{"0", 0, true},
+		{"-1", 0, true},
+		{"6", 0, true},
+		{"many", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := parseViews(tt.value)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseViews(%q) = %d, %v, want %d, error %v", tt.value, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestTTLOptions(t *testing.T) {
+	setupTestConfig(t)
+	config.MaxTTL = 7 * 24 * time.Hour
+	config.DefaultTTL = 24 * time.Hour
+
+	opts := ttlOptions()
+	if len(opts) != 3 {
+		t.Fatalf("got %d options, want 3: %+v", len(opts), opts)
+	}
+	for _, o := range opts {
+		if o.Value > config.MaxTTL {
+			t.Errorf("option %q exceeds MaxTTL", o.Label)
+		}
+		if o.Selected != (o.Value == config.DefaultTTL) {
+			t.Errorf("option %q selected = %v", o.Label, o.Selected)
+		}
+	}
+}
+
+func TestSecretHandler(t *testing.T) {
+	templates = template.Must(template.ParseFS(views, "views/*.html"))
+	setupTestDB(t)
+
+	fullID, _, err := storeSecret(t.Context(), "read me once", secretOptions{TTL: time.Hour})
+	if err != nil {
+		t.Fatalf("storeSecret() error: %v", err)
+	}
+
+	get := func(id string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/get/"+id, nil)
+		req = mux.SetURLVars(req, map[string]string{"key": id})
+		rr := httptest.NewRecorder()
+		SecretHandler(rr, req)
+		return rr
+	}
+
+	rr := get(fullID)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("first read: got status %v want %v", rr.Code, http.StatusOK)
+	}
+	if !strings.Contains(rr.Body.String(), "read me once") {
+		t.Errorf("first read: secret not found in body: %s", rr.Body.String())
+	}
+
+	rr = get(fullID)
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("second read: got status %v want %v", rr.Code, http.StatusNotFound)
+	}
+	if strings.Contains(rr.Body.String(), "read me once") {
+		t.Error("second read: secret was returned again")
+	}
+
+	rr = get("not-a-valid-id")
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("invalid ID: got status %v want %v", rr.Code, http.StatusBadRequest)
+	}
+}
+
+func TestRevealHandler(t *testing.T) {
+	templates = template.Must(template.ParseFS(views, "views/*.html"))
+	setupTestDB(t)
+
+	fullID, _, err := storeSecret(t.Context(), "preview safe", secretOptions{TTL: time.Hour})
+	if err != nil {
+		t.Fatalf("storeSecret() error: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		id         string
+		wantStatus int
+	}{
+		{name: "existing secret", id: fullID, wantStatus: http.StatusOK},
+		{name: "fetching again does not burn", id: fullID, wantStatus: http.StatusOK},
+		{name: "unknown secret", id: "1" + strings.Repeat("a", crypto.LegacyIDLength), wantStatus: http.StatusNotFound},
+		{name: "invalid ID", id: "bad", wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/get/"+tt.id, nil)
+			req = mux.SetURLVars(req, map[string]string{"key": tt.id})
+			rr := httptest.NewRecorder()
+			RevealHandler(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Errorf("got status %v want %v", rr.Code, tt.wantStatus)
+			}
+			if strings.Contains(rr.Body.String(), "preview safe") {
+				t.Error("reveal page must not contain the secret")
+			}
+			if tt.wantStatus == http.StatusOK && !strings.Contains(rr.Body.String(), `action="/get/`+tt.id+`" method="POST"`) {
+				t.Errorf("reveal page is missing the POST form: %s", rr.Body.String())
+			}
+		})
+	}
+
+	sec, err := burnSecret(t.Context(), fullID, "")
+	if err != nil {
+		t.Fatalf("secret was burned by GET requests: %v", err)
+	}
+	if sec.Plaintext != "preview safe" {
+		t.Errorf("burnSecret() = %q, want %q", sec.Plaintext, "preview safe")
+	}
+}
+
 func TestSecretTemplateXSSProtection(t *testing.T) {
 	// Initialize templates
 	templates = template.Must(template.ParseFS(views, "views/*.html"))
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/danstis/go-read-burn/internal/store"
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Metrics only ever hold counts and timings. Labels are limited to fixed sets
+// of values, such as route templates, so no secret or ID can end up in them.
+var (
+	kdfQueueDepth = promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "grb_kdf_queue_depth",
+		Help: "Number of requests waiting for a key derivation slot.",
+	}, func() float64 { return float64(derivations.queueDepth()) })
+
+	kdfRejected = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "grb_kdf_rejected_total",
+		Help: "Number of requests rejected because no key derivation slot became free in time.",
+	})
+
+	kdfDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "grb_kdf_duration_seconds",
+		Help:    "Time taken to derive a key and encrypt or decrypt a secret.",
+		Buckets: prometheus.ExponentialBuckets(0.005, 2, 12),
+	}, []string{"algorithm", "operation"})
+
+	secretsCreated = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "grb_secrets_created_total",
+		Help: "Number of secrets created.",
+	}, []string{"kind"})
+
+	secretsRevealed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "grb_secrets_revealed_total",
+		Help: "Number of times a secret was revealed.",
+	}, []string{"kind"})
+
+	secretsExpired = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "grb_secrets_expired_total",
+		Help: "Number of expired secrets removed by the reaper.",
+	})
+
+	decryptionFailures = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "grb_decryption_failures_total",
+		Help: "Number of reveals that failed to decrypt the secret, because of a wrong ID or passphrase.",
+	})
+
+	secretsStored = promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "grb_secrets_stored",
+		Help: "Number of secrets in the store, including expired secrets not yet removed.",
+	}, countStoredSecrets)
+
+	requestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "grb_http_request_duration_seconds",
+		Help:    "Time taken to serve HTTP requests, by route template.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route", "method", "code"})
+)
+
+// secretKind returns the kind label of a secret or file attachment.
+func secretKind(file bool) string {
+	if file {
+		return "file"
+	}
+	return "text"
+}
+
+// storedSecretsTTL is how long the grb_secrets_stored count is reused.
+// Counting can walk the whole store, and with Redis the whole shared
+// database, so it must not run on every scrape.
+const storedSecretsTTL = time.Minute
+
+// storedSecrets caches the count of countStoredSecrets for st.
+var storedSecrets struct {
+	mu      sync.Mutex
+	st      store.SecretStore
+	count   float64
+	counted time.Time
+}
+
+// countStoredSecrets reads the number of stored secrets for the
+// grb_secrets_stored gauge, at most once per storedSecretsTTL. It reports NaN
+// if the store is unavailable.
+func countStoredSecrets() float64 {
+	if secretStore == nil {
+		return math.NaN()
+	}
+	storedSecrets.mu.Lock()
+	defer storedSecrets.mu.Unlock()
+	if storedSecrets.st == secretStore && time.Since(storedSecrets.counted) < storedSecretsTTL {
+		return storedSecrets.count
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	stats, err := secretStore.Stats(ctx)
+	if err != nil {
+		log.Printf("failed to read store stats: %v", err)
+		return math.NaN()
+	}
+	storedSecrets.st, storedSecrets.count, storedSecrets.counted = secretStore, float64(stats.Secrets), time.Now()
+	return storedSecrets.count
+}
+
+// statusRecorder records the status code written by a handler.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return r.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// routeLabel returns the path template of the route matched for r, so
+// requests for different secrets share a label and IDs are never recorded.
+func routeLabel(r *http.Request) string {
+	if route := mux.CurrentRoute(r); route != nil {
+		if tpl, err := route.GetPathTemplate(); err == nil {
+			return tpl
+		}
+	}
+	return "unmatched"
+}
+
+// metricsMiddleware records the latency of each request in
+// grb_http_request_duration_seconds.
+func metricsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		requestDuration.WithLabelValues(routeLabel(r), r.Method, strconv.Itoa(rec.status)).Observe(time.Since(start).Seconds())
+	})
+}
+
+// createMetricsServer returns a server exposing /metrics on addr, used when
+// Config.MetricsAddr moves the metrics off the public listener.
+func createMetricsServer(addr string) *http.Server {
+	r := mux.NewRouter()
+	r.Handle("/metrics", promhttp.Handler()).Methods("GET")
+	return &http.Server{
+		Handler:      r,
+		Addr:         addr,
+		WriteTimeout: 15 * time.Second,
+		ReadTimeout:  15 * time.Second,
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/danstis/go-read-burn/internal/crypto"
+	"github.com/danstis/go-read-burn/internal/store"
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMetrics(t *testing.T) {
+	r := newTestRouter(t)
+
+	created := testutil.ToFloat64(secretsCreated.WithLabelValues("text"))
+	revealed := testutil.ToFloat64(secretsRevealed.WithLabelValues("text"))
+	failures := testutil.ToFloat64(decryptionFailures)
+	const revealDurations = `grb_http_request_duration_seconds_count{code="200",method="POST",route="/api/v1/secrets/{id}/reveal"}`
+
+	const plaintext = "metrics must not see this"
+	rr := doAPIRequest(t, r, "POST", "/api/v1/secrets", `{"secret":"`+plaintext+`","views":2}`)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("create: got status %v want %v: %s", rr.Code, http.StatusCreated, rr.Body.String())
+	}
+	var resp createSecretResponse
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatalf("create: invalid response: %v", err)
+	}
+	if got := testutil.ToFloat64(secretsStored); got != 1 {
+		t.Errorf("grb_secrets_stored = %v, want 1", got)
+	}
+	reveals := scrapeMetric(t, r, revealDurations)
+
+	if rr := doAPIRequest(t, r, "POST", "/api/v1/secrets/"+withWrongPassword(t, resp.ID)+"/reveal", ""); rr.Code != http.StatusNotFound {
+		t.Errorf("reveal with wrong ID: got status %v want %v", rr.Code, http.StatusNotFound)
+	}
+	if rr := doAPIRequest(t, r, "POST", "/api/v1/secrets/"+resp.ID+"/reveal", ""); rr.Code != http.StatusOK {
+		t.Errorf("reveal: got status %v want %v", rr.Code, http.StatusOK)
+	}
+
+	if got := testutil.ToFloat64(secretsCreated.WithLabelValues("text")) - created; got != 1 {
+		t.Errorf("grb_secrets_created_total increased by %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(secretsRevealed.WithLabelValues("text")) - revealed; got != 1 {
+		t.Errorf("grb_secrets_revealed_total increased by %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(decryptionFailures) - failures; got != 1 {
+		t.Errorf("grb_decryption_failures_total increased by %v, want 1", got)
+	}
+	if got := scrapeMetric(t, r, revealDurations) - reveals; got != 1 {
+		t.Errorf("%s increased by %v, want 1", revealDurations, got)
+	}
+
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, httptest.NewRequest("GET", "/metrics", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("metrics: got status %v want %v", rr.Code, http.StatusOK)
+	}
+	body := rr.Body.String()
+	for _, want := range []string{
+		`grb_kdf_duration_seconds_count{algorithm="scrypt",operation="decrypt"}`,
+		`grb_kdf_duration_seconds_count{algorithm="scrypt",operation="encrypt"}`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics do not contain %s", want)
+		}
+	}
+
+	id, err := crypto.ParseID(resp.ID)
+	if err != nil {
+		t.Fatalf("ParseID() error: %v", err)
+	}
+	for _, leak := range []string{plaintext, id.Key, id.Password} {
+		if strings.Contains(body, leak) {
+			t.Errorf("metrics contain secret material %q", leak)
+		}
+	}
+}
+
+// scrapeMetric returns the value of series on the /metrics page served by h,
+// or 0 if it is not exported yet.
+func scrapeMetric(t *testing.T, h http.Handler, series string) float64 {
+	t.Helper()
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest("GET", "/metrics", nil))
+	for _, line := range strings.Split(rr.Body.String(), "\n") {
+		if value, ok := strings.CutPrefix(line, series+" "); ok {
+			v, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				t.Fatalf("invalid value of %s: %q", series, value)
+			}
+			return v
+		}
+	}
+	return 0
+}
+
+func TestMetricsAddr(t *testing.T) {
+	templates = template.Must(template.ParseFS(views, "views/*.html"))
+	setupTestConfig(t)
+	config.MetricsAddr = "127.0.0.1:9090"
+	r := mux.NewRouter()
+	setupRoutes(r)
+
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, httptest.NewRequest("GET", "/metrics", nil))
+	if rr.Code == http.StatusOK {
+		t.Error("metrics are served on the public listener when GRB_METRICS_ADDR is set")
+	}
+
+	rr = httptest.NewRecorder()
+	createMetricsServer(config.MetricsAddr).Handler.ServeHTTP(rr, httptest.NewRequest("GET", "/metrics", nil))
+	if rr.Code != http.StatusOK {
+		t.Errorf("metrics server: got status %v want %v", rr.Code, http.StatusOK)
+	}
+}
+
+func TestCountStoredSecrets_Cached(t *testing.T) {
+	setupTestConfig(t)
+	setupTestDB(t)
+
+	if got := countStoredSecrets(); got != 0 {
+		t.Fatalf("countStoredSecrets() = %v, want 0", got)
+	}
+	rec := store.Record{Ciphertext: []byte("ct"), ExpiresAt: time.Now().Add(time.Hour)}
+	if err := secretStore.Put(t.Context(), "key00001", rec); err != nil {
+		t.Fatal(err)
+	}
+	if got := countStoredSecrets(); got != 0 {
+		t.Errorf("countStoredSecrets() = %v within %v of the last count, want the cached 0", got, storedSecretsTTL)
+	}
+
+	// A different store is always counted.
+	prev := secretStore
+	secretStore = store.NewMemory()
+	t.Cleanup(func() { secretStore = prev })
+	if err := secretStore.Put(t.Context(), "key00001", rec); err != nil {
+		t.Fatal(err)
+	}
+	if got := countStoredSecrets(); got != 1 {
+		t.Errorf("countStoredSecrets() of a new store = %v, want 1", got)
+	}
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/netip"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"golang.org/x/time/rate"
+)
+
+// Route names, used to apply rate limits to routes.
+const (
+	routeCreate    = "create"
+	routeReveal    = "reveal"
+	routeSecret    = "secret"
+	routeAPICreate = "api-create"
+	routeAPIReveal = "api-reveal"
+)
+
+var (
+	// rateLimits maps route names to the limiter applied to them. Routes
+	// without a limiter are not rate limited.
+	rateLimits map[string]*rateLimiter
+	// trustedProxies are the networks whose X-Forwarded-For headers are
+	// trusted to name the client.
+	trustedProxies []netip.Prefix
+)
+
+// ipv6ClientBits is the prefix length of the network an IPv6 client is rate
+// limited by.
+const ipv6ClientBits = 64
+
+// rateLimiter is a per client IP token bucket rate limiter.
+type rateLimiter struct {
+	limit rate.Limit
+	burst int
+
+	mu        sync.Mutex
+	clients   map[string]*rateClient
+	lastPrune time.Time
+}
+
+// rateClient is the bucket of a single client IP.
+type rateClient struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// newRateLimiter returns a limiter allowing each client perMinute requests a
+// minute on average, and up to burst requests at once.
+func newRateLimiter(perMinute float64, burst int) *rateLimiter {
+	return &rateLimiter{
+		limit:   rate.Limit(perMinute / 60),
+		burst:   burst,
+		clients: make(map[string]*rateClient),
+	}
+}
+
+// newRateLimits returns the rate limits configured in c. A limit of 0
+// disables rate limiting of that kind of request.
+func newRateLimits(c Config) map[string]*rateLimiter {
+	limits := make(map[string]*rateLimiter)
+	if c.CreateRateLimit > 0 {
+		l := newRateLimiter(c.CreateRateLimit, c.CreateRateBurst)
+		limits[routeCreate], limits[routeAPICreate] = l, l
+	}
+	if c.RevealRateLimit > 0 {
+		l := newRateLimiter(c.RevealRateLimit, c.RevealRateBurst)
+		limits[routeReveal], limits[routeSecret], limits[routeAPIReveal] = l, l, l
+	}
+	// Each readiness check writes to the store, so it is always limited.
+	limits[routeReadyz] = newRateLimiter(readyzRateLimit, readyzRateBurst)
+	return limits
+}
+
+// allow takes a token from the bucket of ip. If the bucket is empty it
+// returns false and how long until a token is available.
+func (l *rateLimiter) allow(ip string, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.prune(now)
+	c, ok := l.clients[ip]
+	if !ok {
+		c = &rateClient{limiter: rate.NewLimiter(l.limit, l.burst)}
+		l.clients[ip] = c
+	}
+	c.lastSeen = now
+
+	res := c.limiter.ReserveN(now, 1)
+	if !res.OK() {
+		return false, time.Minute
+	}
+	if delay := res.DelayFrom(now); delay > 0 {
+		res.CancelAt(now)
+		return false, delay
+	}
+	return true, 0
+}
+
+// prune forgets clients whose buckets have filled up again, as they behave
+// the same as new clients. It runs at most once a minute.
+func (l *rateLimiter) prune(now time.Time) {
+	if now.Sub(l.lastPrune) < time.Minute {
+		return
+	}
+	l.lastPrune = now
+
+	refill := time.Duration(float64(l.burst) / float64(l.limit) * float64(time.Second))
+	for ip, c := range l.clients {
+		if now.Sub(c.lastSeen) > refill {
+			delete(l.clients, ip)
+		}
+	}
+}
+
+// rateLimitMiddleware rejects requests from clients that have exceeded the rate
+// limit of the matched route with 429 Too Many Requests.
+func rateLimitMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := mux.CurrentRoute(r)
+		if route == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		l := rateLimits[route.GetName()]
+		if l == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ok, retryAfter := l.allow(rateLimitKey(r), time.Now())
+		if !ok {
+			setRetryAfter(w, retryAfter)
+			if strings.HasPrefix(route.GetName(), "api-") {
+				writeAPIError(w, http.StatusTooManyRequests, "rate_limited", "too many requests, please slow down")
+			} else {
+				renderError(w, http.StatusTooManyRequests, "Too many requests, please wait a moment and try again.")
+			}
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// rateLimitKey returns the key of the bucket limiting r: the client IP, or the
+// /64 network of an IPv6 client, which can usually pick any address in it.
+func rateLimitKey(r *http.Request) string {
+	ip := clientIP(r)
+	addr, err := netip.ParseAddr(ip)
+	if err != nil || !addr.Is6() {
+		return ip
+	}
+	return netip.PrefixFrom(addr.WithZone(""), ipv6ClientBits).Masked().String()
+}
+
+// clientIP returns the IP address of the client that made r. X-Forwarded-For
+// is only used when the request comes from a trusted proxy, in which case the
+// client is the rightmost address that is not a trusted proxy itself, as
+// addresses further left can be set by the client.
+func clientIP(r *http.Request) string {
+	addr, err := netip.ParseAddrPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	ip := addr.Addr().Unmap()
+	if !isTrustedProxy(ip) {
+		return ip.String()
+	}
+
+	forwarded := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(forwarded[i]))
+		if err != nil {
+			break
+		}
+		ip = hop.Unmap()
+		if !isTrustedProxy(ip) {
+			break
+		}
+	}
+	return ip.String()
+}
+
+// isHTTPS reports whether r was made over HTTPS, either directly or to a
+// trusted proxy that says so in X-Forwarded-Proto.
+func isHTTPS(r *http.Request) bool {
+	if r.TLS != nil {
+		return true
+	}
+	addr, err := netip.ParseAddrPort(r.RemoteAddr)
+	if err != nil || !isTrustedProxy(addr.Addr().Unmap()) {
+		return false
+	}
+	return r.Header.Get("X-Forwarded-Proto") == "https"
+}
+
+// isTrustedProxy reports whether ip belongs to one of the trustedProxies.
+func isTrustedProxy(ip netip.Addr) bool {
+	for _, p := range trustedProxies {
+		if p.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseTrustedProxies parses a list of IP addresses and CIDR networks.
+func parseTrustedProxies(list []string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, s := range list {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		if !strings.Contains(s, "/") {
+			ip, err := netip.ParseAddr(s)
+			if err != nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q: %w", s, err)
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(ip.Unmap(), ip.Unmap().BitLen()))
+			continue
+		}
+		p, err := netip.ParsePrefix(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", s, err)
+		}
+		prefixes = append(prefixes, p.Masked())
+	}
+	return prefixes, nil
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter_Allow(t *testing.T) {
+	l := newRateLimiter(60, 2)
+	now := time.Now()
+
+	for i := 0; i < 2; i++ {
+		if ok, _ := l.allow("192.0.2.1", now); !ok {
+			t.Fatalf("request %d within burst was rejected", i+1)
+		}
+	}
+	ok, retryAfter := l.allow("192.0.2.1", now)
+	if ok {
+		t.Fatal("request beyond burst was allowed")
+	}
+	if retryAfter <= 0 || retryAfter > time.Second {
+		t.Errorf("retry after = %v, want up to 1s", retryAfter)
+	}
+
+	if ok, _ := l.allow("192.0.2.2", now); !ok {
+		t.Error("request from another client was rejected")
+	}
+	if ok, _ := l.allow("192.0.2.1", now.Add(time.Second)); !ok {
+		t.Error("request after the bucket refilled was rejected")
+	}
+}
+
+func TestRateLimiter_Prune(t *testing.T) {
+	l := newRateLimiter(60, 2)
+	now := time.Now()
+	l.allow("192.0.2.1", now)
+	l.allow("192.0.2.2", now.Add(time.Minute))
+
+	// The first client's bucket has refilled after 2s, the second's has not.
+	l.allow("192.0.2.3", now.Add(time.Minute+time.Second))
+	if _, ok := l.clients["192.0.2.1"]; ok {
+		t.Error("idle client was not pruned")
+	}
+	if _, ok := l.clients["192.0.2.2"]; !ok {
+		t.Error("active client was pruned")
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	prev := trustedProxies
+	t.Cleanup(func() { trustedProxies = prev })
+	var err error
+	trustedProxies, err = parseTrustedProxies([]string{"10.0.0.0/8", "2001:db8::1"})
+	if err != nil {
+		t.Fatalf("parseTrustedProxies() error: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  []string
+		want       string
+	}{
+		{name: "direct", remoteAddr: "192.0.2.1:1234", want: "192.0.2.1"},
+		{name: "untrusted proxy", remoteAddr: "192.0.2.1:1234", forwarded: []string{"198.51.100.7"}, want: "192.0.2.1"},
+		{name: "trusted proxy", remoteAddr: "10.1.2.3:1234", forwarded: []string{"198.51.100.7"}, want: "198.51.100.7"},
+		{name: "spoofed entry", remoteAddr: "10.1.2.3:1234", forwarded: []string{"203.0.113.9, 198.51.100.7"}, want: "198.51.100.7"},
+		{name: "chained proxies", remoteAddr: "10.1.2.3:1234", forwarded: []string{"198.51.100.7, 10.9.9.9"}, want: "198.51.100.7"},
+		{name: "repeated header", remoteAddr: "10.1.2.3:1234", forwarded: []string{"203.0.113.9", "198.51.100.7"}, want: "198.51.100.7"},
+		{name: "malformed header", remoteAddr: "10.1.2.3:1234", forwarded: []string{"not-an-ip"}, want: "10.1.2.3"},
+		{name: "no header", remoteAddr: "10.1.2.3:1234", want: "10.1.2.3"},
+		{name: "IPv6 trusted proxy", remoteAddr: "[2001:db8::1]:443", forwarded: []string{"2001:db8::42"}, want: "2001:db8::42"},
+		{name: "IPv4 mapped", remoteAddr: "[::ffff:192.0.2.1]:1234", want: "192.0.2.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			for _, v := range tt.forwarded {
+				req.Header.Add("X-Forwarded-For", v)
+			}
+			if got := clientIP(req); got != tt.want {
+				t.Errorf("clientIP() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRateLimitKey(t *testing.T) {
+	tests := []struct {
+		remoteAddr string
+		want       string
+	}{
+		{"192.0.2.1:1234", "192.0.2.1"},
+		{"[::ffff:192.0.2.1]:1234", "192.0.2.1"},
+		{"[2001:db8:1:2:3:4:5:6]:1234", "2001:db8:1:2::/64"},
+		{"[2001:db8:1:2:ffff::1]:1234", "2001:db8:1:2::/64"},
+		{"[fe80::1%eth0]:1234", "fe80::/64"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = tt.remoteAddr
+		if got := rateLimitKey(req); got != tt.want {
+			t.Errorf("rateLimitKey() for %s = %q, want %q", tt.remoteAddr, got, tt.want)
+		}
+	}
+}
+
+func TestParseTrustedProxies(t *testing.T) {
+	got, err := parseTrustedProxies([]string{"10.1.2.3/8", " 192.0.2.1 ", ""})
+	if err != nil {
+		t.Fatalf("parseTrustedProxies() error: %v", err)
+	}
+	want := []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8"), netip.MustParsePrefix("192.0.2.1/32")}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("parseTrustedProxies() = %v, want %v", got, want)
+	}
+
+	for _, bad := range []string{"10.0.0.0/33", "proxy.example.com"} {
+		if _, err := parseTrustedProxies([]string{bad}); err == nil {
+			t.Errorf("parseTrustedProxies(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	r := newTestRouter(t)
+	prev := rateLimits
+	t.Cleanup(func() { rateLimits = prev })
+	rateLimits = newRateLimits(Config{CreateRateLimit: 1, CreateRateBurst: 1, RevealRateLimit: 1, RevealRateBurst: 2})
+
+	do := func(method, target, remoteAddr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(`{"secret":"s"}`))
+		req.RemoteAddr = remoteAddr
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := do("POST", "/api/v1/secrets", "192.0.2.1:1234"); rr.Code != http.StatusCreated {
+		t.Fatalf("first create: got status %v want %v", rr.Code, http.StatusCreated)
+	}
+	rr := do("POST", "/api/v1/secrets", "192.0.2.1:1234")
+	assertAPIError(t, rr, http.StatusTooManyRequests, "rate_limited")
+	if rr.Header().Get("Retry-After") == "" {
+		t.Error("Retry-After header not set")
+	}
+
+	// The web form shares the create limit, and renders the error page.
+	rr = do("POST", "/create", "192.0.2.1:1234")
+	if rr.Code != http.StatusTooManyRequests {
+		t.Errorf("form create: got status %v want %v", rr.Code, http.StatusTooManyRequests)
+	}
+	if !strings.Contains(rr.Body.String(), "Too many requests") {
+		t.Errorf("form create: body does not explain the error: %s", rr.Body.String())
+	}
+
+	// IPv6 clients cannot get a fresh bucket by rotating addresses within
+	// their /64.
+	if rr := do("POST", "/api/v1/secrets", "[2001:db8::1]:1234"); rr.Code != http.StatusCreated {
+		t.Fatalf("first IPv6 create: got status %v want %v", rr.Code, http.StatusCreated)
+	}
+	assertAPIError(t, do("POST", "/api/v1/secrets", "[2001:db8::2]:1234"), http.StatusTooManyRequests, "rate_limited")
+
+	// Reveals have their own limit, and other clients are unaffected.
+	if rr := do("POST", "/api/v1/secrets", "192.0.2.2:1234"); rr.Code != http.StatusCreated {
+		t.Errorf("create from another client: got status %v want %v", rr.Code, http.StatusCreated)
+	}
+	id := strings.Repeat("a", 72)
+	for i := 0; i < 2; i++ {
+		if rr := do("GET", "/get/"+id, "192.0.2.1:1234"); rr.Code != http.StatusNotFound {
+			t.Errorf("reveal %d: got status %v want %v", i+1, rr.Code, http.StatusNotFound)
+		}
+	}
+	if rr := do("POST", "/get/"+id, "192.0.2.1:1234"); rr.Code != http.StatusTooManyRequests {
+		t.Errorf("reveal beyond burst: got status %v want %v", rr.Code, http.StatusTooManyRequests)
+	}
+
+	// Static files are not limited.
+	if rr := do("GET", "/static/js/messageCount.js", "192.0.2.1:1234"); rr.Code == http.StatusTooManyRequests {
+		t.Error("static file was rate limited")
+	}
+}
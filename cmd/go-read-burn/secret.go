@@ -0,0 +1,352 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/danstis/go-read-burn/internal/crypto"
+	"github.com/danstis/go-read-burn/internal/store"
+)
+
+// maxKeyAttempts is the number of times storeSecret retries ID generation when
+// the generated key collides with an existing secret.
+const maxKeyAttempts = 3
+
+var (
+	errSecretTooLarge     = errors.New("secret is too large")
+	errPassphraseRequired = errors.New("secret is protected by a passphrase")
+	errTooManyAttempts    = errors.New("too many incorrect passphrase attempts, the secret has been destroyed")
+)
+
+// wrongPassphraseError is returned by burnSecret when the passphrase does not
+// decrypt a passphrase protected secret, with the attempts left before the
+// secret is destroyed.
+type wrongPassphraseError struct {
+	Remaining int
+}
+
+func (e *wrongPassphraseError) Error() string {
+	if e.Remaining < 0 {
+		return "passphrase is incorrect"
+	}
+	return fmt.Sprintf("passphrase is incorrect, %d attempt(s) remaining", e.Remaining)
+}
+
+// secretOptions controls how a secret is stored.
+type secretOptions struct {
+	// TTL is how long the secret is kept before it expires.
+	TTL time.Duration
+	// ClientEncrypted marks the plaintext as ciphertext produced by the
+	// browser, which the server cannot decrypt any further.
+	ClientEncrypted bool
+	// Passphrase is mixed into the key derivation, so the secret can only be
+	// revealed with both the ID and the passphrase.
+	Passphrase string
+	// Views is the number of times the secret can be revealed before it is
+	// deleted. Values below 1 are treated as 1.
+	Views int
+}
+
+// secretInfo describes a stored secret without revealing it.
+type secretInfo struct {
+	Passphrase     bool
+	RemainingViews int
+	File           bool
+}
+
+// secret is a secret that has been revealed. File is set instead of Plaintext
+// for file attachments.
+type secret struct {
+	Plaintext       string
+	File            *fileAttachment
+	ClientEncrypted bool
+	// RemainingViews is the number of times the secret can still be revealed
+	// after this view.
+	RemainingViews int
+}
+
+// secretTooLarge reports whether secret is longer than Config.MaxSecretSize
+// bytes. Client encrypted secrets are measured by the plaintext they decrypt
+// to, so the limit is the same whichever side encrypts the secret.
+func secretTooLarge(secret string, clientEncrypted bool) bool {
+	size := len(secret)
+	if clientEncrypted {
+		size = crypto.ClientPlaintextSize(secret)
+	}
+	return int64(size) > config.MaxSecretSize
+}
+
+// storeSecret encrypts plaintext under a newly generated ID and saves the
+// ciphertext in the secret store, to expire after opts.TTL. It returns the full
+// ID needed to decrypt the secret and the time it expires.
+func storeSecret(ctx context.Context, plaintext string, opts secretOptions) (string, time.Time, error) {
+	return storePayload(ctx, []byte(plaintext), false, opts)
+}
+
+// storeFile is like storeSecret for a file attachment. The filename and
+// content type are encrypted together with the file data.
+func storeFile(ctx context.Context, f fileAttachment, opts secretOptions) (string, time.Time, error) {
+	if len(f.Data) == 0 {
+		return "", time.Time{}, crypto.ErrEmptyPlaintext
+	}
+	payload, err := encodeFile(f)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return storePayload(ctx, payload, true, opts)
+}
+
+// storePayload encrypts and saves payload for storeSecret and storeFile.
+func storePayload(ctx context.Context, payload []byte, file bool, opts secretOptions) (string, time.Time, error) {
+	for i := 0; i < maxKeyAttempts; i++ {
+		id, err := crypto.GenerateID()
+		if err != nil {
+			return "", time.Time{}, err
+		}
+
+		release, err := derivations.acquire(ctx)
+		if err != nil {
+			return "", time.Time{}, err
+		}
+		done := measureKDF(ctx, kdfParams, "encrypt")
+		ciphertext, err := id.Encrypt(payload, opts.Passphrase, kdfParams)
+		done()
+		release()
+		if err != nil {
+			return "", time.Time{}, err
+		}
+
+		rec := store.Record{
+			Ciphertext:      ciphertext,
+			ExpiresAt:       time.Now().Add(opts.TTL).UTC(),
+			ClientEncrypted: opts.ClientEncrypted,
+			Passphrase:      opts.Passphrase != "",
+			RemainingViews:  max(opts.Views, 1),
+			File:            file,
+			KDF:             kdfParams.String(),
+		}
+		err = secretStore.Put(ctx, id.Key, rec)
+		if errors.Is(err, store.ErrKeyExists) {
+			continue
+		}
+		if err != nil {
+			return "", time.Time{}, err
+		}
+		secretsCreated.WithLabelValues(secretKind(file)).Inc()
+		return id.String(), rec.ExpiresAt, nil
+	}
+	return "", time.Time{}, store.ErrKeyExists
+}
+
+// lookupSecret returns details of the unexpired secret stored for the given ID
+// without decrypting or removing it, or store.ErrNotFound if there is none.
+func lookupSecret(ctx context.Context, fullID string) (secretInfo, error) {
+	id, err := crypto.ParseID(fullID)
+	if err != nil {
+		return secretInfo{}, err
+	}
+
+	rec, err := secretStore.Get(ctx, id.Key)
+	if err != nil {
+		return secretInfo{}, err
+	}
+	return secretInfo{Passphrase: rec.Passphrase, RemainingViews: rec.Views(), File: rec.File}, nil
+}
+
+// burnSecret looks up and decrypts the secret for the given ID and deletes it
+// once it has used up its views. The secret is decrypted from a copy of the
+// record before SecretStore.TakeOnce updates its remaining views, so the key
+// derivation holds neither the store nor a slot while waiting for the other.
+// The update only applies while the record holds the same ciphertext, so
+// concurrent requests for the same ID can never receive the secret more times
+// than allowed. If decryption fails the secret is left in place. Expired
+// secrets are deleted and reported as not found.
+//
+// Passphrase protected secrets require the passphrase. Each failed attempt to
+// decrypt one is counted, and the secret is deleted once
+// Config.MaxPassphraseAttempts is reached. A wrong ID and a wrong passphrase
+// are indistinguishable, so both count as failed attempts. A passphrase given
+// for a secret without one is ignored.
+func burnSecret(ctx context.Context, fullID, passphrase string) (secret, error) {
+	id, err := crypto.ParseID(fullID)
+	if err != nil {
+		return secret{}, err
+	}
+
+	rec, err := secretStore.Get(ctx, id.Key)
+	if errors.Is(err, store.ErrNotFound) {
+		// Get leaves expired records in place, TakeOnce deletes them.
+		err = secretStore.TakeOnce(ctx, id.Key, func(store.Record) (*store.Record, error) {
+			return nil, store.ErrNotFound
+		})
+		return secret{}, err
+	}
+	if err != nil {
+		return secret{}, err
+	}
+	if rec.Passphrase && passphrase == "" {
+		return secret{}, errPassphraseRequired
+	}
+	if !rec.Passphrase {
+		passphrase = ""
+	}
+
+	plaintext, err := decryptRecord(ctx, id, rec, passphrase)
+	if errors.Is(err, crypto.ErrDecryptionFailed) && rec.Passphrase {
+		return secret{}, countFailedAttempt(ctx, id.Key, rec)
+	}
+	if err != nil {
+		return secret{}, err
+	}
+
+	sec := secret{ClientEncrypted: rec.ClientEncrypted}
+	if rec.File {
+		f, err := decodeFile(plaintext)
+		if err != nil {
+			return secret{}, err
+		}
+		sec.File = &f
+	} else {
+		sec.Plaintext = string(plaintext)
+	}
+
+	err = secretStore.TakeOnce(ctx, id.Key, func(cur store.Record) (*store.Record, error) {
+		if !sameSecret(cur, rec) {
+			return nil, store.ErrNotFound
+		}
+		sec.RemainingViews = cur.Views() - 1
+		if sec.RemainingViews == 0 {
+			return nil, nil
+		}
+		cur.RemainingViews = sec.RemainingViews
+		return &cur, nil
+	})
+	if err != nil {
+		return secret{}, err
+	}
+	secretsRevealed.WithLabelValues(secretKind(sec.File != nil)).Inc()
+	return sec, nil
+}
+
+// decryptRecord decrypts the ciphertext of rec with id and passphrase, waiting
+// for a key derivation slot first.
+func decryptRecord(ctx context.Context, id crypto.ID, rec store.Record, passphrase string) ([]byte, error) {
+	kdf, err := crypto.ParseKDFParams(rec.KDF)
+	if err != nil {
+		return nil, err
+	}
+	release, err := derivations.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	done := measureKDF(ctx, kdf, "decrypt")
+	plaintext, err := id.Decrypt(rec.Ciphertext, passphrase, kdf)
+	done()
+	if errors.Is(err, crypto.ErrDecryptionFailed) {
+		decryptionFailures.Inc()
+	}
+	return plaintext, err
+}
+
+// countFailedAttempt records a failed passphrase attempt against the secret
+// stored under key, which was read as rec. It returns the error to report for
+// the attempt.
+func countFailedAttempt(ctx context.Context, key string, rec store.Record) error {
+	var attemptErr error
+	err := secretStore.TakeOnce(ctx, key, func(cur store.Record) (*store.Record, error) {
+		if !sameSecret(cur, rec) {
+			return nil, store.ErrNotFound
+		}
+		updated, remaining := recordFailedAttempt(cur)
+		attemptErr = &wrongPassphraseError{Remaining: remaining}
+		if remaining == 0 {
+			attemptErr = errTooManyAttempts
+		}
+		return updated, nil
+	})
+	if err != nil {
+		return err
+	}
+	return attemptErr
+}
+
+// sameSecret reports whether cur holds the same secret as rec, which was read
+// earlier. Only the counters of a record change while it is stored.
+func sameSecret(cur, rec store.Record) bool {
+	return bytes.Equal(cur.Ciphertext, rec.Ciphertext) && cur.KDF == rec.KDF
+}
+
+// recordFailedAttempt counts a failed passphrase attempt against rec. It
+// returns the record to store, which is nil once Config.MaxPassphraseAttempts
+// is reached, and the number of attempts remaining, which is 0 once the secret
+// is to be deleted and -1 when attempts are unlimited.
+func recordFailedAttempt(rec store.Record) (*store.Record, int) {
+	rec.FailedAttempts++
+	if config.MaxPassphraseAttempts <= 0 {
+		return &rec, -1
+	}
+	remaining := config.MaxPassphraseAttempts - rec.FailedAttempts
+	if remaining <= 0 {
+		return nil, 0
+	}
+	return &rec, remaining
+}
+
+// reaper periodically removes expired secrets from the store in the background.
+type reaper struct {
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// startReaper starts a goroutine that sweeps expired secrets from st every
+// interval until Stop is called. An interval of 0 disables the reaper, for
+// backends that expire secrets themselves.
+func startReaper(st store.SecretStore, interval time.Duration) *reaper {
+	rp := &reaper{
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	if interval <= 0 {
+		close(rp.done)
+		return rp
+	}
+
+	go func() {
+		defer close(rp.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-rp.stop:
+				return
+			case now := <-ticker.C:
+				n, err := st.Expire(context.Background(), now)
+				if err != nil {
+					log.Printf("failed to remove expired secrets: %v", err)
+					continue
+				}
+				secretsExpired.Add(float64(n))
+				if n > 0 {
+					log.Printf("removed %d expired secret(s)", n)
+				}
+			}
+		}
+	}()
+
+	return rp
+}
+
+// Stop stops the reaper and waits for any sweep in progress to finish.
+func (rp *reaper) Stop() {
+	rp.stopOnce.Do(func() { close(rp.stop) })
+	<-rp.done
+}
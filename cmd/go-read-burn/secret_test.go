@@ -0,0 +1,344 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/danstis/go-read-burn/internal/crypto"
+	"github.com/danstis/go-read-burn/internal/store"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestBurnSecret_WrongPasswordKeepsSecret(t *testing.T) {
+	setupTestDB(t)
+
+	fullID, _, err := storeSecret(t.Context(), "still here", secretOptions{TTL: time.Hour})
+	if err != nil {
+		t.Fatalf("storeSecret() error: %v", err)
+	}
+
+	wrongID := withWrongPassword(t, fullID)
+	if _, err := burnSecret(t.Context(), wrongID, ""); err != crypto.ErrDecryptionFailed {
+		t.Fatalf("burnSecret() with wrong password error = %v, want %v", err, crypto.ErrDecryptionFailed)
+	}
+
+	sec, err := burnSecret(t.Context(), fullID, "")
+	if err != nil {
+		t.Fatalf("burnSecret() error: %v", err)
+	}
+	if sec.Plaintext != "still here" {
+		t.Errorf("burnSecret() = %q, want %q", sec.Plaintext, "still here")
+	}
+}
+
+func TestBurnSecret_Passphrase(t *testing.T) {
+	setupTestConfig(t)
+	setupTestDB(t)
+	config.MaxPassphraseAttempts = 3
+
+	fullID, _, err := storeSecret(t.Context(), "second factor", secretOptions{TTL: time.Hour, Passphrase: "open sesame"})
+	if err != nil {
+		t.Fatalf("storeSecret() error: %v", err)
+	}
+
+	if info, err := lookupSecret(t.Context(), fullID); err != nil || !info.Passphrase {
+		t.Errorf("lookupSecret() = %+v, %v, want a passphrase protected secret", info, err)
+	}
+
+	if _, err := burnSecret(t.Context(), fullID, ""); err != errPassphraseRequired {
+		t.Errorf("burnSecret() without passphrase error = %v, want %v", err, errPassphraseRequired)
+	}
+
+	for _, want := range []int{2, 1} {
+		_, err := burnSecret(t.Context(), fullID, "wrong")
+		wrong, ok := err.(*wrongPassphraseError)
+		if !ok || wrong.Remaining != want {
+			t.Fatalf("burnSecret() with wrong passphrase error = %v, want %d attempt(s) remaining", err, want)
+		}
+	}
+
+	sec, err := burnSecret(t.Context(), fullID, "open sesame")
+	if err != nil {
+		t.Fatalf("burnSecret() error: %v", err)
+	}
+	if sec.Plaintext != "second factor" {
+		t.Errorf("burnSecret() = %q, want %q", sec.Plaintext, "second factor")
+	}
+}
+
+func TestBurnSecret_PassphraseAttemptsExhausted(t *testing.T) {
+	setupTestConfig(t)
+	setupTestDB(t)
+	config.MaxPassphraseAttempts = 2
+
+	fullID, _, err := storeSecret(t.Context(), "guess me", secretOptions{TTL: time.Hour, Passphrase: "right"})
+	if err != nil {
+		t.Fatalf("storeSecret() error: %v", err)
+	}
+
+	if _, err := burnSecret(t.Context(), fullID, "wrong"); err == nil {
+		t.Fatal("burnSecret() with wrong passphrase succeeded")
+	}
+	if _, err := burnSecret(t.Context(), fullID, "still wrong"); err != errTooManyAttempts {
+		t.Fatalf("burnSecret() error = %v, want %v", err, errTooManyAttempts)
+	}
+	if _, err := burnSecret(t.Context(), fullID, "right"); err != store.ErrNotFound {
+		t.Errorf("burnSecret() after too many attempts error = %v, want %v", err, store.ErrNotFound)
+	}
+	if n := countSecrets(t); n != 0 {
+		t.Errorf("secret was not destroyed, %d secrets remain", n)
+	}
+}
+
+func TestBurnSecret_MultipleViews(t *testing.T) {
+	setupTestDB(t)
+
+	fullID, _, err := storeSecret(t.Context(), "shared with three", secretOptions{TTL: time.Hour, Views: 3})
+	if err != nil {
+		t.Fatalf("storeSecret() error: %v", err)
+	}
+
+	for _, want := range []int{2, 1, 0} {
+		sec, err := burnSecret(t.Context(), fullID, "")
+		if err != nil {
+			t.Fatalf("burnSecret() error: %v", err)
+		}
+		if sec.Plaintext != "shared with three" || sec.RemainingViews != want {
+			t.Errorf("burnSecret() = %+v, want %d remaining views", sec, want)
+		}
+	}
+
+	if _, err := burnSecret(t.Context(), fullID, ""); err != store.ErrNotFound {
+		t.Errorf("burnSecret() after last view error = %v, want %v", err, store.ErrNotFound)
+	}
+	if n := countSecrets(t); n != 0 {
+		t.Errorf("secret was not deleted after its last view, %d secrets remain", n)
+	}
+}
+
+func TestBurnSecret_Concurrent(t *testing.T) {
+	setupTestDB(t)
+
+	fullID, _, err := storeSecret(t.Context(), "only one of you gets this", secretOptions{TTL: time.Hour})
+	if err != nil {
+		t.Fatalf("storeSecret() error: %v", err)
+	}
+
+	const readers = 5
+	var (
+		wg        sync.WaitGroup
+		mu        sync.Mutex
+		successes int
+	)
+	for i := 0; i < readers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := burnSecret(t.Context(), fullID, "")
+			if err == nil {
+				mu.Lock()
+				successes++
+				mu.Unlock()
+			} else if err != store.ErrNotFound {
+				t.Errorf("burnSecret() unexpected error: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if successes != 1 {
+		t.Errorf("secret was read %d times, want exactly 1", successes)
+	}
+}
+
+// lockingStore serialises TakeOnce calls, like a backend locking the whole
+// store while fn runs.
+type lockingStore struct {
+	store.SecretStore
+	mu sync.Mutex
+}
+
+func (s *lockingStore) TakeOnce(ctx context.Context, key string, fn store.TakeFunc) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.SecretStore.TakeOnce(ctx, key, fn)
+}
+
+func TestBurnSecret_ConcurrentKDF(t *testing.T) {
+	setupTestDB(t)
+	secretStore = &lockingStore{SecretStore: secretStore}
+	// Full-cost derivations take long enough to overlap reliably, and make
+	// this the round trip covering the default parameters.
+	t.Cleanup(func() { kdfParams = testKDF })
+	kdfParams = crypto.DefaultKDF
+
+	var ids []string
+	for _, plaintext := range []string{"first", "second"} {
+		fullID, _, err := storeSecret(t.Context(), plaintext, secretOptions{TTL: time.Hour})
+		if err != nil {
+			t.Fatalf("storeSecret() error: %v", err)
+		}
+		ids = append(ids, fullID)
+	}
+	exporter := setupTestTracer(t)
+
+	// Reveals of different secrets must derive their keys in parallel, even
+	// if the store takes records one at a time.
+	var wg sync.WaitGroup
+	for _, fullID := range ids {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := burnSecret(t.Context(), fullID, ""); err != nil {
+				t.Errorf("burnSecret() error: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	var kdfs []tracetest.SpanStub
+	for _, s := range exporter.GetSpans() {
+		if s.Name == "kdf decrypt" {
+			kdfs = append(kdfs, s)
+		}
+	}
+	if len(kdfs) != 2 {
+		t.Fatalf("got %d decrypt spans, want 2", len(kdfs))
+	}
+	if a, b := kdfs[0], kdfs[1]; !a.StartTime.Before(b.EndTime) || !b.StartTime.Before(a.EndTime) {
+		t.Errorf("key derivations ran %v-%v and %v-%v, want them to overlap",
+			a.StartTime.Format(time.StampMicro), a.EndTime.Format(time.StampMicro),
+			b.StartTime.Format(time.StampMicro), b.EndTime.Format(time.StampMicro))
+	}
+}
+
+func TestBurnSecret_Expired(t *testing.T) {
+	setupTestDB(t)
+
+	fullID, _, err := storeSecret(t.Context(), "too late", secretOptions{TTL: -time.Minute})
+	if err != nil {
+		t.Fatalf("storeSecret() error: %v", err)
+	}
+
+	if _, err := lookupSecret(t.Context(), fullID); err != store.ErrNotFound {
+		t.Errorf("lookupSecret() error = %v, want %v for an expired secret", err, store.ErrNotFound)
+	}
+
+	if _, err := burnSecret(t.Context(), fullID, ""); err != store.ErrNotFound {
+		t.Errorf("burnSecret() error = %v, want %v", err, store.ErrNotFound)
+	}
+
+	if n := countSecrets(t); n != 0 {
+		t.Errorf("expired secret was not deleted, %d secrets remain", n)
+	}
+}
+
+func TestBurnSecret_LegacyID(t *testing.T) {
+	setupTestDB(t)
+
+	// Links issued before IDs were versioned must keep working.
+	id, err := crypto.ParseID("legacy01" + strings.Repeat("p", crypto.PasswordLength) +
+		strings.Repeat("n", crypto.NonceLength) + strings.Repeat("s", crypto.SaltLength))
+	if err != nil {
+		t.Fatalf("ParseID() error: %v", err)
+	}
+	ciphertext, err := crypto.Encrypt("from the old days", id.Password, id.Nonce, id.Salt)
+	if err != nil {
+		t.Fatalf("Encrypt() error: %v", err)
+	}
+	rec := store.Record{Ciphertext: ciphertext, ExpiresAt: time.Now().Add(time.Hour)}
+	if err := secretStore.Put(t.Context(), id.Key, rec); err != nil {
+		t.Fatalf("Put() error: %v", err)
+	}
+
+	fullID := id.String()
+	if len(fullID) != crypto.LegacyIDLength {
+		t.Fatalf("legacy ID length = %d, want %d", len(fullID), crypto.LegacyIDLength)
+	}
+	sec, err := burnSecret(t.Context(), fullID, "")
+	if err != nil {
+		t.Fatalf("burnSecret() error: %v", err)
+	}
+	if sec.Plaintext != "from the old days" {
+		t.Errorf("burnSecret() = %q, want %q", sec.Plaintext, "from the old days")
+	}
+}
+
+func TestBurnSecret_KDFChanged(t *testing.T) {
+	setupTestDB(t)
+	t.Cleanup(func() { kdfParams = testKDF })
+
+	kdfParams = crypto.KDFParams{Algorithm: crypto.KDFArgon2id, Time: 1, Memory: 64, Threads: 1}
+	fullID, _, err := storeSecret(t.Context(), "derived with argon2id", secretOptions{TTL: time.Hour})
+	if err != nil {
+		t.Fatalf("storeSecret() error: %v", err)
+	}
+	if rec := storedRecord(t, fullID); rec.KDF != kdfParams.String() {
+		t.Errorf("stored KDF = %q, want %q", rec.KDF, kdfParams)
+	}
+
+	// Secrets must be revealed with the parameters they were stored with,
+	// whatever the current configuration.
+	kdfParams = testKDF
+	sec, err := burnSecret(t.Context(), fullID, "")
+	if err != nil {
+		t.Fatalf("burnSecret() error: %v", err)
+	}
+	if sec.Plaintext != "derived with argon2id" {
+		t.Errorf("burnSecret() = %q, want %q", sec.Plaintext, "derived with argon2id")
+	}
+}
+
+func TestReaper(t *testing.T) {
+	setupTestDB(t)
+
+	if _, _, err := storeSecret(t.Context(), "short lived", secretOptions{TTL: 10 * time.Millisecond}); err != nil {
+		t.Fatalf("storeSecret() error: %v", err)
+	}
+
+	expired := testutil.ToFloat64(secretsExpired)
+	rp := startReaper(secretStore, 10*time.Millisecond)
+	deadline := time.Now().Add(5 * time.Second)
+	for countSecrets(t) > 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	rp.Stop()
+	rp.Stop() // Stopping twice must not panic.
+
+	if n := countSecrets(t); n != 0 {
+		t.Errorf("reaper did not remove the expired secret, %d secrets remain", n)
+	}
+	if got := testutil.ToFloat64(secretsExpired) - expired; got != 1 {
+		t.Errorf("grb_secrets_expired_total increased by %v, want 1", got)
+	}
+}
+
+// countSecrets returns the number of secrets stored in the test store.
+func countSecrets(t *testing.T) int {
+	t.Helper()
+	stats, err := secretStore.Stats(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return stats.Secrets
+}
+
+func TestReaper_Disabled(t *testing.T) {
+	setupTestDB(t)
+
+	if _, _, err := storeSecret(t.Context(), "left for the backend", secretOptions{TTL: -time.Minute}); err != nil {
+		t.Fatalf("storeSecret() error: %v", err)
+	}
+
+	rp := startReaper(secretStore, 0)
+	time.Sleep(20 * time.Millisecond)
+	rp.Stop()
+
+	if n := countSecrets(t); n != 1 {
+		t.Errorf("disabled reaper changed the store, %d secrets remain, want 1", n)
+	}
+}
@@ -0,0 +1,71 @@
+// Browser-side encryption for secrets that the server never sees in plaintext.
+//
+// Secrets are encrypted with AES-256-GCM under a random key. The ciphertext is
+// sent to the server as base64(nonce || sealed data) and the key is base64url
+// encoded into the URL fragment, which browsers never send to the server.
+const grbCrypto = (function () {
+  const nonceLength = 12;
+
+  function available() {
+    return Boolean(globalThis.crypto && globalThis.crypto.subtle);
+  }
+
+  function toBase64(bytes) {
+    let binary = "";
+    bytes.forEach(function (b) {
+      binary += String.fromCodePoint(b);
+    });
+    return btoa(binary);
+  }
+
+  function fromBase64(text) {
+    return Uint8Array.from(atob(text), function (c) {
+      return c.codePointAt(0);
+    });
+  }
+
+  function toBase64URL(bytes) {
+    return toBase64(bytes).replaceAll("+", "-").replaceAll("/", "_").replace(/=+$/, "");
+  }
+
+  function fromBase64URL(text) {
+    return fromBase64(text.replaceAll("-", "+").replaceAll("_", "/"));
+  }
+
+  // encrypt returns the base64 ciphertext of plaintext and the base64url key
+  // needed to decrypt it.
+  async function encrypt(plaintext) {
+    const key = await crypto.subtle.generateKey({ name: "AES-GCM", length: 256 }, true, ["encrypt"]);
+    const nonce = crypto.getRandomValues(new Uint8Array(nonceLength));
+    const sealed = await crypto.subtle.encrypt(
+      { name: "AES-GCM", iv: nonce },
+      key,
+      new TextEncoder().encode(plaintext)
+    );
+
+    const data = new Uint8Array(nonceLength + sealed.byteLength);
+    data.set(nonce);
+    data.set(new Uint8Array(sealed), nonceLength);
+    const rawKey = new Uint8Array(await crypto.subtle.exportKey("raw", key));
+    return { ciphertext: toBase64(data), key: toBase64URL(rawKey) };
+  }
+
+  // decrypt reverses encrypt, rejecting if the key does not match.
+  async function decrypt(ciphertext, encodedKey) {
+    const data = fromBase64(ciphertext);
+    const key = await crypto.subtle.importKey("raw", fromBase64URL(encodedKey), "AES-GCM", false, ["decrypt"]);
+    const plaintext = await crypto.subtle.decrypt(
+      { name: "AES-GCM", iv: data.slice(0, nonceLength) },
+      key,
+      data.slice(nonceLength)
+    );
+    return new TextDecoder().decode(plaintext);
+  }
+
+  // fragmentKey returns the key from the current URL fragment, if any.
+  function fragmentKey() {
+    return globalThis.location.hash.replace(/^#/, "");
+  }
+
+  return { available, encrypt, decrypt, fragmentKey };
+})();
@@ -1,10 +1,15 @@
-const text_max = 8000;
-$("#input_count").html("Password or secret (0 / " + text_max + " chars):");
+// The server limits secrets to GRB_MAX_SECRET_SIZE bytes, which the index page
+// passes in data-max-size. Count UTF-8 bytes rather than characters to match.
+const text_max = $("#inputText").data("max-size");
+const encoder = new TextEncoder();
 
-$("#inputText").keyup(function () {
-  let text_length = $("#inputText").val().length;
+function updateCount() {
+  let text_length = encoder.encode($("#inputText").val()).length;
 
-  $("#input_count").html(
-    "Password or secret (" + text_length + " / " + text_max + " chars):"
-  );
-});
+  $("#input_count")
+    .html("Password or secret (" + text_length + " / " + text_max + " bytes):")
+    .toggleClass("text-danger", text_length > text_max);
+}
+
+updateCount();
+$("#inputText").on("input", updateCount);
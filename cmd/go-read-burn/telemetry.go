@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/danstis/go-read-burn/internal/crypto"
+	"github.com/danstis/go-read-burn/internal/store"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/propagation"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentationName identifies the spans and metrics of this service.
+const instrumentationName = "github.com/danstis/go-read-burn"
+
+// The tracer and meter come from the global providers, which only export
+// anything once setupTelemetry has installed real ones. Attributes are limited
+// to route templates, operation names and key derivation algorithms, so no
+// secret, passphrase or ID is ever recorded.
+var (
+	tracer = otel.Tracer(instrumentationName)
+	meter  = otel.Meter(instrumentationName)
+
+	otelRequestDuration = mustHistogram("http.server.request.duration", "Duration of HTTP server requests.")
+	otelStoreDuration   = mustHistogram("grb.store.duration", "Duration of secret store operations.")
+	otelKDFDuration     = mustHistogram("grb.kdf.duration", "Duration of key derivation and encryption or decryption of a secret.")
+)
+
+// mustHistogram creates a histogram measured in seconds.
+func mustHistogram(name, description string) metric.Float64Histogram {
+	h, err := meter.Float64Histogram(name, metric.WithDescription(description), metric.WithUnit("s"))
+	if err != nil {
+		panic(err)
+	}
+	return h
+}
+
+// setupTelemetry exports traces and metrics over OTLP/HTTP to endpoint, such
+// as http://localhost:4318. The returned function flushes and stops the
+// exporters.
+func setupTelemetry(ctx context.Context, endpoint string) (func(context.Context) error, error) {
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(
+		semconv.ServiceName("go-read-burn"),
+		semconv.ServiceVersion(version),
+	))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create resource: %w", err)
+	}
+
+	traceExporter, err := otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(endpoint))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create trace exporter: %w", err)
+	}
+	metricExporter, err := otlpmetrichttp.New(ctx, otlpmetrichttp.WithEndpointURL(endpoint))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create metric exporter: %w", err)
+	}
+
+	tp := sdktrace.NewTracerProvider(sdktrace.WithBatcher(traceExporter), sdktrace.WithResource(res))
+	mp := sdkmetric.NewMeterProvider(sdkmetric.WithReader(sdkmetric.NewPeriodicReader(metricExporter)), sdkmetric.WithResource(res))
+	otel.SetTracerProvider(tp)
+	otel.SetMeterProvider(mp)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	return func(ctx context.Context) error {
+		return errors.Join(tp.Shutdown(ctx), mp.Shutdown(ctx))
+	}, nil
+}
+
+// tracingMiddleware starts a server span for each request, named after the
+// route template rather than the path, which may contain a secret ID.
+func tracingMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		route := routeLabel(r)
+		attrs := []attribute.KeyValue{
+			semconv.HTTPRequestMethodKey.String(r.Method),
+			semconv.HTTPRoute(route),
+		}
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := tracer.Start(ctx, r.Method+" "+route, trace.WithSpanKind(trace.SpanKindServer), trace.WithAttributes(attrs...))
+		defer span.End()
+
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r.WithContext(ctx))
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+
+		span.SetAttributes(semconv.HTTPResponseStatusCode(rec.status))
+		if rec.status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, strconv.Itoa(rec.status))
+		}
+		attrs = append(attrs, semconv.HTTPResponseStatusCode(rec.status))
+		otelRequestDuration.Record(ctx, time.Since(start).Seconds(), metric.WithAttributes(attrs...))
+	})
+}
+
+// measureKDF starts timing a key derivation with k for the Prometheus and
+// OpenTelemetry metrics, in a span of its own. The returned function stops
+// the timer.
+func measureKDF(ctx context.Context, k crypto.KDFParams, operation string) func() {
+	start := time.Now()
+	attrs := metric.WithAttributes(attribute.String("grb.kdf.algorithm", k.Algorithm), attribute.String("grb.kdf.operation", operation))
+	ctx, span := tracer.Start(ctx, "kdf "+operation, trace.WithAttributes(
+		attribute.String("grb.kdf.algorithm", k.Algorithm),
+		attribute.String("grb.kdf.operation", operation),
+	))
+	return func() {
+		elapsed := time.Since(start).Seconds()
+		kdfDuration.WithLabelValues(k.Algorithm, operation).Observe(elapsed)
+		otelKDFDuration.Record(ctx, elapsed, attrs)
+		span.End()
+	}
+}
+
+// tracedStore wraps a store.SecretStore with a span for each operation. Keys
+// are part of the secret ID, so they are never recorded.
+type tracedStore struct {
+	store.SecretStore
+	backend string
+}
+
+// traceStore returns st instrumented with spans and duration metrics.
+func traceStore(st store.SecretStore, backend string) store.SecretStore {
+	return &tracedStore{SecretStore: st, backend: backend}
+}
+
+// start starts the span of a store operation. The returned function ends it,
+// recording err unless it only reports a missing record.
+func (s *tracedStore) start(ctx context.Context, operation string) (context.Context, func(err error)) {
+	start := time.Now()
+	attrs := []attribute.KeyValue{
+		semconv.DBSystemNameKey.String(s.backend),
+		semconv.DBOperationName(operation),
+	}
+	ctx, span := tracer.Start(ctx, "store "+operation, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+	return ctx, func(err error) {
+		if err != nil && !errors.Is(err, store.ErrNotFound) {
+			span.SetStatus(codes.Error, err.Error())
+		}
+		otelStoreDuration.Record(ctx, time.Since(start).Seconds(), metric.WithAttributes(attrs...))
+		span.End()
+	}
+}
+
+func (s *tracedStore) Put(ctx context.Context, key string, rec store.Record) (err error) {
+	ctx, end := s.start(ctx, "put")
+	defer func() { end(err) }()
+	return s.SecretStore.Put(ctx, key, rec)
+}
+
+func (s *tracedStore) Get(ctx context.Context, key string) (rec store.Record, err error) {
+	ctx, end := s.start(ctx, "get")
+	defer func() { end(err) }()
+	return s.SecretStore.Get(ctx, key)
+}
+
+func (s *tracedStore) TakeOnce(ctx context.Context, key string, fn store.TakeFunc) (err error) {
+	ctx, end := s.start(ctx, "take")
+	defer func() { end(err) }()
+	return s.SecretStore.TakeOnce(ctx, key, fn)
+}
+
+func (s *tracedStore) Delete(ctx context.Context, key string) (err error) {
+	ctx, end := s.start(ctx, "delete")
+	defer func() { end(err) }()
+	return s.SecretStore.Delete(ctx, key)
+}
+
+func (s *tracedStore) Expire(ctx context.Context, now time.Time) (n int, err error) {
+	ctx, end := s.start(ctx, "expire")
+	defer func() { end(err) }()
+	return s.SecretStore.Expire(ctx, now)
+}
+
+func (s *tracedStore) Stats(ctx context.Context) (stats store.Stats, err error) {
+	ctx, end := s.start(ctx, "stats")
+	defer func() { end(err) }()
+	return s.SecretStore.Stats(ctx)
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/danstis/go-read-burn/internal/crypto"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// setupTestTracer replaces the package level tracer with one recording spans
+// in memory, and returns the exporter holding them.
+func setupTestTracer(t *testing.T) *tracetest.InMemoryExporter {
+	t.Helper()
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	prev := tracer
+	tracer = tp.Tracer(instrumentationName)
+	t.Cleanup(func() {
+		tracer = prev
+		tp.Shutdown(t.Context())
+	})
+	return exporter
+}
+
+func TestTelemetry_Spans(t *testing.T) {
+	r := newTestRouter(t)
+	secretStore = traceStore(secretStore, "bolt")
+	exporter := setupTestTracer(t)
+
+	const plaintext, passphrase = "traced secret", "traced passphrase"
+	rr := doAPIRequest(t, r, "POST", "/api/v1/secrets", fmt.Sprintf(`{"secret":%q,"passphrase":%q}`, plaintext, passphrase))
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("create: got status %v want %v: %s", rr.Code, http.StatusCreated, rr.Body.String())
+	}
+	var resp createSecretResponse
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatalf("create: invalid response: %v", err)
+	}
+	doAPIRequest(t, r, "GET", "/get/"+resp.ID, "")
+	doAPIRequest(t, r, "POST", "/api/v1/secrets/"+resp.ID+"/reveal", `{"passphrase":"wrong"}`)
+	if rr := doAPIRequest(t, r, "POST", "/api/v1/secrets/"+resp.ID+"/reveal", fmt.Sprintf(`{"passphrase":%q}`, passphrase)); rr.Code != http.StatusOK {
+		t.Fatalf("reveal: got status %v want %v: %s", rr.Code, http.StatusOK, rr.Body.String())
+	}
+
+	spans := exporter.GetSpans()
+	byName := make(map[string]tracetest.SpanStub)
+	for _, s := range spans {
+		byName[s.Name] = s
+	}
+	for _, name := range []string{
+		"POST /api/v1/secrets", "GET /get/{key}", "POST /api/v1/secrets/{id}/reveal",
+		"store put", "store get", "store take", "kdf encrypt", "kdf decrypt",
+	} {
+		if _, ok := byName[name]; !ok {
+			t.Errorf("no %q span recorded", name)
+		}
+	}
+	if put, create := byName["store put"], byName["POST /api/v1/secrets"]; put.Parent.SpanID() != create.SpanContext.SpanID() {
+		t.Error("store span is not a child of the request span")
+	}
+
+	id, err := crypto.ParseID(resp.ID)
+	if err != nil {
+		t.Fatalf("ParseID() error: %v", err)
+	}
+	sensitive := []string{plaintext, passphrase, resp.ID, id.Key, id.Password}
+	for _, s := range spans {
+		var recorded []string
+		recorded = append(recorded, s.Name, s.Status.Description)
+		for _, kv := range s.Attributes {
+			recorded = append(recorded, string(kv.Key), kv.Value.Emit())
+		}
+		for _, e := range s.Events {
+			recorded = append(recorded, e.Name)
+			for _, kv := range e.Attributes {
+				recorded = append(recorded, kv.Value.Emit())
+			}
+		}
+		for _, value := range recorded {
+			for _, leak := range sensitive {
+				if strings.Contains(value, leak) {
+					t.Errorf("span %q records secret material %q", s.Name, leak)
+				}
+			}
+		}
+	}
+}
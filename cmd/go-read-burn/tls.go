@@ -0,0 +1,188 @@
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// certPollInterval is how often the certificate files are checked for
+// changes.
+const certPollInterval = 10 * time.Second
+
+// tlsVersions maps the accepted values of GRB_TLS_MIN_VERSION to versions.
+var tlsVersions = map[string]uint16{
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// certReloader serves a certificate and key pair loaded from files, and loads
+// them again when they change so renewed certificates are used without a
+// restart.
+type certReloader struct {
+	certFile, keyFile string
+
+	mu      sync.RWMutex
+	cert    *tls.Certificate
+	modTime time.Time
+}
+
+// newCertReloader loads the certificate and key pair from certFile and
+// keyFile.
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	c := &certReloader{certFile: certFile, keyFile: keyFile}
+	if err := c.reload(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// reload loads the certificate and key pair from disk. If they cannot be
+// loaded the previous pair stays in use.
+func (c *certReloader) reload() error {
+	modTime, err := c.filesModTime()
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cert = &cert
+	c.modTime = modTime
+	return nil
+}
+
+// reloadIfChanged reloads the certificate and key pair if either file has
+// been modified since they were last loaded, and reports whether it did.
+func (c *certReloader) reloadIfChanged() (bool, error) {
+	modTime, err := c.filesModTime()
+	if err != nil {
+		return false, err
+	}
+	c.mu.RLock()
+	changed := !modTime.Equal(c.modTime)
+	c.mu.RUnlock()
+	if !changed {
+		return false, nil
+	}
+	return true, c.reload()
+}
+
+// filesModTime returns the latest modification time of the certificate and
+// key files. Symlinks are followed, so Kubernetes secret updates are seen.
+func (c *certReloader) filesModTime() (time.Time, error) {
+	var latest time.Time
+	for _, name := range []string{c.certFile, c.keyFile} {
+		fi, err := os.Stat(name)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("failed to read TLS certificate: %w", err)
+		}
+		if fi.ModTime().After(latest) {
+			latest = fi.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+// watch reloads the certificate and key pair in the background when the
+// files change, checking every interval, or when the process receives SIGHUP.
+func (c *certReloader) watch(interval time.Duration) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-hup:
+				if err := c.reload(); err != nil {
+					log.Printf("failed to reload TLS certificate: %v", err)
+					continue
+				}
+				log.Println("reloaded TLS certificate")
+			case <-ticker.C:
+				reloaded, err := c.reloadIfChanged()
+				if err != nil {
+					log.Printf("failed to reload TLS certificate: %v", err)
+					continue
+				}
+				if reloaded {
+					log.Println("reloaded TLS certificate")
+				}
+			}
+		}
+	}()
+}
+
+// GetCertificate implements tls.Config.GetCertificate.
+func (c *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.cert, nil
+}
+
+// setupTLS returns the TLS configuration for the certificate and key files in
+// config, reloading them as they change.
+func setupTLS(config Config) (*tls.Config, error) {
+	minVersion, ok := tlsVersions[config.TLSMinVersion]
+	if !ok {
+		return nil, fmt.Errorf("unsupported minimum TLS version %q, want 1.2 or 1.3", config.TLSMinVersion)
+	}
+	if config.TLSCertFile == "" || config.TLSKeyFile == "" {
+		return nil, errors.New("GRB_TLS_CERT_FILE and GRB_TLS_KEY_FILE must be set together")
+	}
+
+	certs, err := newCertReloader(config.TLSCertFile, config.TLSKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	certs.watch(certPollInterval)
+	return &tls.Config{
+		MinVersion:     minVersion,
+		GetCertificate: certs.GetCertificate,
+	}, nil
+}
+
+// createRedirectServer returns a server on addr that redirects every request
+// to the same URL over HTTPS on httpsPort.
+func createRedirectServer(addr, httpsPort string) *http.Server {
+	return &http.Server{
+		Handler:      redirectToHTTPS(httpsPort),
+		Addr:         addr,
+		WriteTimeout: 15 * time.Second,
+		ReadTimeout:  15 * time.Second,
+	}
+}
+
+// redirectToHTTPS returns a handler redirecting requests to HTTPS on
+// httpsPort, which is left out of the URL when it is the default 443.
+func redirectToHTTPS(httpsPort string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.Host)
+		if err != nil {
+			host = strings.TrimSuffix(strings.TrimPrefix(r.Host, "["), "]")
+		}
+		if httpsPort != "443" {
+			host = net.JoinHostPort(host, httpsPort)
+		} else if strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+		target := "https://" + host + r.URL.RequestURI()
+		http.Redirect(w, r, target, http.StatusMovedPermanently)
+	})
+}
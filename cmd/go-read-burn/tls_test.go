@@ -0,0 +1,161 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeTestCert writes a self-signed certificate for commonName and its key
+// to dir, returning the paths of the certificate and key files.
+func writeTestCert(t *testing.T, dir, commonName string) (string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+// servedCommonName returns the common name of the certificate served by the
+// TLS server at addr.
+func servedCommonName(t *testing.T, addr string) string {
+	t.Helper()
+	conn, err := tls.Dial("tcp", addr, &tls.Config{InsecureSkipVerify: true})
+	if err != nil {
+		t.Fatalf("tls.Dial() error: %v", err)
+	}
+	defer conn.Close()
+	return conn.ConnectionState().PeerCertificates[0].Subject.CommonName
+}
+
+func TestCertReloader(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeTestCert(t, dir, "first")
+
+	c, err := newCertReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("newCertReloader() error: %v", err)
+	}
+	if reloaded, err := c.reloadIfChanged(); reloaded || err != nil {
+		t.Errorf("reloadIfChanged() of unchanged files = %v, %v, want false", reloaded, err)
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &http.Server{TLSConfig: &tls.Config{GetCertificate: c.GetCertificate}}
+	go srv.ServeTLS(ln, "", "")
+	t.Cleanup(func() { srv.Close() })
+	if cn := servedCommonName(t, ln.Addr().String()); cn != "first" {
+		t.Fatalf("served certificate %q, want %q", cn, "first")
+	}
+
+	// Rewrite the files with a new certificate, as a renewal would.
+	writeTestCert(t, dir, "second")
+	later := time.Now().Add(time.Minute)
+	for _, f := range []string{certFile, keyFile} {
+		if err := os.Chtimes(f, later, later); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if reloaded, err := c.reloadIfChanged(); !reloaded || err != nil {
+		t.Fatalf("reloadIfChanged() of renewed files = %v, %v, want true", reloaded, err)
+	}
+	if cn := servedCommonName(t, ln.Addr().String()); cn != "second" {
+		t.Errorf("served certificate %q after reloading, want %q", cn, "second")
+	}
+
+	// A broken renewal keeps the previous certificate in service.
+	if err := os.WriteFile(keyFile, []byte("not a key"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.reload(); err == nil {
+		t.Error("reload() of a broken key succeeded")
+	}
+	if cn := servedCommonName(t, ln.Addr().String()); cn != "second" {
+		t.Errorf("served certificate %q after a failed reload, want %q", cn, "second")
+	}
+}
+
+func TestSetupTLS(t *testing.T) {
+	certFile, keyFile := writeTestCert(t, t.TempDir(), "test")
+
+	cfg, err := setupTLS(Config{TLSCertFile: certFile, TLSKeyFile: keyFile, TLSMinVersion: "1.3"})
+	if err != nil {
+		t.Fatalf("setupTLS() error: %v", err)
+	}
+	if cfg.MinVersion != tls.VersionTLS13 {
+		t.Errorf("MinVersion = %x, want %x", cfg.MinVersion, tls.VersionTLS13)
+	}
+
+	for name, c := range map[string]Config{
+		"old TLS version": {TLSCertFile: certFile, TLSKeyFile: keyFile, TLSMinVersion: "1.0"},
+		"missing key":     {TLSCertFile: certFile, TLSMinVersion: "1.2"},
+		"missing file":    {TLSCertFile: certFile, TLSKeyFile: keyFile + ".missing", TLSMinVersion: "1.2"},
+	} {
+		if _, err := setupTLS(c); err == nil {
+			t.Errorf("%s: setupTLS() succeeded", name)
+		}
+	}
+}
+
+func TestRedirectToHTTPS(t *testing.T) {
+	tests := []struct {
+		port   string
+		target string
+		want   string
+	}{
+		{"443", "http://example.com/get/abc?x=1", "https://example.com/get/abc?x=1"},
+		{"443", "http://example.com:80/", "https://example.com/"},
+		{"8443", "http://example.com:8080/api/v1/secrets", "https://example.com:8443/api/v1/secrets"},
+		{"443", "http://[::1]:80/", "https://[::1]/"},
+		{"8443", "http://[::1]/", "https://[::1]:8443/"},
+	}
+	for _, tt := range tests {
+		rr := httptest.NewRecorder()
+		redirectToHTTPS(tt.port).ServeHTTP(rr, httptest.NewRequest("GET", tt.target, nil))
+		if rr.Code != http.StatusMovedPermanently {
+			t.Errorf("%s: got status %v want %v", tt.target, rr.Code, http.StatusMovedPermanently)
+		}
+		if got := rr.Header().Get("Location"); got != tt.want {
+			t.Errorf("%s: redirected to %q, want %q", tt.target, got, tt.want)
+		}
+	}
+}
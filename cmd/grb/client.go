@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// client talks to the JSON API of a go-read-burn server.
+type client struct {
+	baseURL    string
+	httpClient *http.Client
+}
+
+func newClient(baseURL string) *client {
+	return &client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		httpClient: &http.Client{Timeout: 60 * time.Second},
+	}
+}
+
+type createRequest struct {
+	Secret     string `json:"secret"`
+	TTL        string `json:"ttl,omitempty"`
+	Passphrase string `json:"passphrase,omitempty"`
+	Views      int    `json:"views,omitempty"`
+}
+
+type revealRequest struct {
+	Passphrase string `json:"passphrase,omitempty"`
+}
+
+type createResponse struct {
+	ID        string    `json:"id"`
+	URL       string    `json:"url"`
+	ExpiresAt time.Time `json:"expires_at"`
+	Views     int       `json:"views"`
+}
+
+type revealResponse struct {
+	Secret          string        `json:"secret"`
+	File            *fileResponse `json:"file"`
+	ClientEncrypted bool          `json:"client_encrypted"`
+	RemainingViews  int           `json:"remaining_views"`
+}
+
+type fileResponse struct {
+	Filename    string `json:"filename"`
+	ContentType string `json:"content_type"`
+	Data        []byte `json:"data"`
+}
+
+// apiError is an error response returned by the server.
+type apiError struct {
+	Status  int
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("%s (HTTP %d %s)", e.Message, e.Status, e.Code)
+}
+
+// Create stores the secret in req on the server and returns the created
+// secret details.
+func (c *client) Create(req createRequest) (createResponse, error) {
+	var resp createResponse
+	err := c.post("/api/v1/secrets", req, &resp)
+	return resp, err
+}
+
+// CreateFile uploads data as a file attachment named filename, with the
+// options in req, and returns the created secret details.
+func (c *client) CreateFile(req createRequest, filename string, data []byte) (createResponse, error) {
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	fields := map[string]string{"ttl": req.TTL, "passphrase": req.Passphrase}
+	if req.Views > 0 {
+		fields["views"] = strconv.Itoa(req.Views)
+	}
+	for k, v := range fields {
+		if v == "" {
+			continue
+		}
+		if err := mw.WriteField(k, v); err != nil {
+			return createResponse{}, err
+		}
+	}
+	fw, err := mw.CreateFormFile("file", filename)
+	if err != nil {
+		return createResponse{}, err
+	}
+	if _, err := fw.Write(data); err != nil {
+		return createResponse{}, err
+	}
+	if err := mw.Close(); err != nil {
+		return createResponse{}, err
+	}
+
+	var resp createResponse
+	err = c.send("/api/v1/secrets", mw.FormDataContentType(), &buf, &resp)
+	return resp, err
+}
+
+// Reveal fetches and burns the secret with the given ID, using passphrase if
+// the secret is passphrase protected.
+func (c *client) Reveal(id, passphrase string) (revealResponse, error) {
+	var resp revealResponse
+	err := c.post("/api/v1/secrets/"+url.PathEscape(id)+"/reveal", revealRequest{Passphrase: passphrase}, &resp)
+	return resp, err
+}
+
+// post sends body as JSON to path and decodes the JSON response into out.
+func (c *client) post(path string, body, out interface{}) error {
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			return err
+		}
+	}
+	return c.send(path, "application/json", &buf, out)
+}
+
+// send posts body to path and decodes the JSON response into out.
+func (c *client) send(path, contentType string, body io.Reader, out interface{}) error {
+	resp, err := c.httpClient.Post(c.baseURL+path, contentType, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		var errResp struct {
+			Error apiError `json:"error"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&errResp); err != nil || errResp.Error.Code == "" {
+			return &apiError{Status: resp.StatusCode, Code: "unknown", Message: resp.Status}
+		}
+		errResp.Error.Status = resp.StatusCode
+		return &errResp.Error
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("invalid response from server: %w", err)
+	}
+	return nil
+}
+
+// parseSecretRef splits a share URL into the server base URL, secret ID and
+// the browser encryption key held in the URL fragment, if any. A bare ID is
+// returned with an empty base URL.
+func parseSecretRef(ref string) (baseURL, id, key string, err error) {
+	if !strings.Contains(ref, "/") {
+		id, key, _ = strings.Cut(ref, "#")
+		return "", id, key, nil
+	}
+
+	u, err := url.Parse(ref)
+	if err != nil {
+		return "", "", "", fmt.Errorf("invalid secret URL: %w", err)
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return "", "", "", fmt.Errorf("invalid secret URL %q", ref)
+	}
+
+	prefix, id, ok := strings.Cut(u.Path, "/get/")
+	if !ok || id == "" || strings.Contains(id, "/") {
+		return "", "", "", fmt.Errorf("secret URL %q does not contain /get/<id>", ref)
+	}
+	return u.Scheme + "://" + u.Host + prefix, id, u.Fragment, nil
+}
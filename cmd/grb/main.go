@@ -0,0 +1,268 @@
+// Command grb is a command-line client for a go-read-burn server. It creates
+// secrets from stdin or a file and reveals secrets from their share URL.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/danstis/go-read-burn/internal/crypto"
+)
+
+// Exit codes returned by grb.
+const (
+	exitOK             = 0
+	exitError          = 1
+	exitUsage          = 2
+	exitNotFound       = 3
+	exitInvalidID      = 4
+	exitDecryptionFail = 5
+	exitPassphrase     = 6
+)
+
+const usage = `Usage:
+  grb create [-server URL] [-ttl DURATION] [-views N] [-passphrase PASSPHRASE] [-attach] [FILE]
+  grb reveal [-server URL] [-passphrase PASSPHRASE] [-o PATH] URL|ID
+
+create reads the secret from FILE, or from stdin when FILE is omitted or "-",
+and prints the share URL. With -attach, FILE is shared as a file attachment
+instead. reveal fetches, prints and burns the secret, writing it to PATH if -o
+is given. Secrets encrypted in the browser are decrypted with the key in the
+URL fragment.
+
+The server defaults to $GRB_SERVER, or http://localhost:80 if unset. The
+passphrase defaults to $GRB_PASSPHRASE, which keeps it out of the process list.
+
+Exit codes:
+  0  success
+  1  request or server error
+  2  invalid usage
+  3  secret does not exist, has expired or has already been viewed
+  4  secret ID is malformed
+  5  URL key is missing or does not decrypt a browser-encrypted secret
+  6  passphrase is missing or incorrect
+`
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run executes the grb command line and returns the process exit code.
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return exitUsage
+	}
+
+	switch args[0] {
+	case "create":
+		return runCreate(args[1:], stdin, stdout, stderr)
+	case "reveal":
+		return runReveal(args[1:], stdout, stderr)
+	case "help", "-h", "-help", "--help":
+		fmt.Fprint(stdout, usage)
+		return exitOK
+	default:
+		fmt.Fprintf(stderr, "grb: unknown command %q\n\n%s", args[0], usage)
+		return exitUsage
+	}
+}
+
+func runCreate(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := newFlagSet("create", stderr)
+	server := fs.String("server", defaultServer(), "go-read-burn server URL")
+	ttl := fs.String("ttl", "", "time until the secret expires, e.g. 1h (defaults to the server default)")
+	views := fs.Int("views", 1, "number of times the secret can be revealed")
+	passphrase := fs.String("passphrase", os.Getenv("GRB_PASSPHRASE"), "passphrase the recipient needs as well as the link")
+	attach := fs.Bool("attach", false, "share FILE as a file attachment")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if fs.NArg() > 1 {
+		fmt.Fprintln(stderr, "grb: create accepts at most one file")
+		return exitUsage
+	}
+
+	req := createRequest{
+		TTL:        *ttl,
+		Passphrase: *passphrase,
+		Views:      *views,
+	}
+	var created createResponse
+	var err error
+	if *attach {
+		name := fs.Arg(0)
+		if name == "" || name == "-" {
+			fmt.Fprintln(stderr, "grb: -attach requires a file")
+			return exitUsage
+		}
+		var data []byte
+		data, err = os.ReadFile(name)
+		if err != nil {
+			fmt.Fprintf(stderr, "grb: %v\n", err)
+			return exitError
+		}
+		if len(data) == 0 {
+			fmt.Fprintln(stderr, "grb: file is empty")
+			return exitUsage
+		}
+		created, err = newClient(*server).CreateFile(req, filepath.Base(name), data)
+	} else {
+		req.Secret, err = readSecret(fs.Arg(0), stdin)
+		if err != nil {
+			fmt.Fprintf(stderr, "grb: %v\n", err)
+			return exitError
+		}
+		if req.Secret == "" {
+			fmt.Fprintln(stderr, "grb: secret is empty")
+			return exitUsage
+		}
+		created, err = newClient(*server).Create(req)
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "grb: %v\n", err)
+		return exitCode(err)
+	}
+
+	fmt.Fprintln(stdout, created.URL)
+	return exitOK
+}
+
+func runReveal(args []string, stdout, stderr io.Writer) int {
+	fs := newFlagSet("reveal", stderr)
+	server := fs.String("server", defaultServer(), "go-read-burn server URL, used when revealing a bare ID")
+	passphrase := fs.String("passphrase", os.Getenv("GRB_PASSPHRASE"), "passphrase of a passphrase protected secret")
+	output := fs.String("o", "", "write the secret to this file instead of stdout")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if fs.NArg() != 1 {
+		fmt.Fprintln(stderr, "grb: reveal requires exactly one secret URL or ID")
+		return exitUsage
+	}
+
+	baseURL, id, key, err := parseSecretRef(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintf(stderr, "grb: %v\n", err)
+		return exitInvalidID
+	}
+	if baseURL == "" {
+		baseURL = *server
+	}
+
+	revealed, err := newClient(baseURL).Reveal(id, *passphrase)
+	if err != nil {
+		fmt.Fprintf(stderr, "grb: %v\n", err)
+		return exitCode(err)
+	}
+
+	// The secret has been burned on the server by now, so it is written to
+	// the output even when it is only partially viewable.
+	out := stdout
+	if *output != "" {
+		f, err := os.OpenFile(*output, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+		if err != nil {
+			fmt.Fprintf(stderr, "grb: %v\n", err)
+			return exitError
+		}
+		defer f.Close()
+		out = f
+	}
+
+	if revealed.File != nil {
+		if _, err := out.Write(revealed.File.Data); err != nil {
+			fmt.Fprintf(stderr, "grb: failed to write file: %v\n", err)
+			return exitError
+		}
+		fmt.Fprintf(stderr, "grb: revealed file %q (%s, %d bytes)\n", revealed.File.Filename, revealed.File.ContentType, len(revealed.File.Data))
+		printRemainingViews(stderr, revealed.RemainingViews)
+		return exitOK
+	}
+
+	secret := revealed.Secret
+	if revealed.ClientEncrypted {
+		// The secret has been burned on the server by now, so a missing or
+		// wrong key means it is lost.
+		secret, err = crypto.DecryptClient(revealed.Secret, key)
+		if err != nil {
+			fmt.Fprintf(stderr, "grb: secret was encrypted in the browser and could not be decrypted with the key in the URL: %v\n", err)
+			return exitDecryptionFail
+		}
+	}
+
+	fmt.Fprint(out, secret)
+	if !strings.HasSuffix(secret, "\n") {
+		fmt.Fprintln(out)
+	}
+	printRemainingViews(stderr, revealed.RemainingViews)
+	return exitOK
+}
+
+// printRemainingViews tells the user how many more times a multi-view secret
+// can be revealed.
+func printRemainingViews(w io.Writer, remaining int) {
+	if remaining > 0 {
+		fmt.Fprintf(w, "grb: secret can be viewed %d more time(s)\n", remaining)
+	}
+}
+
+func newFlagSet(name string, output io.Writer) *flag.FlagSet {
+	fs := flag.NewFlagSet("grb "+name, flag.ContinueOnError)
+	fs.SetOutput(output)
+	return fs
+}
+
+// defaultServer returns the server URL from $GRB_SERVER, falling back to the
+// server's default listen address.
+func defaultServer() string {
+	if s := os.Getenv("GRB_SERVER"); s != "" {
+		return s
+	}
+	return "http://localhost:80"
+}
+
+// readSecret reads the secret from the named file, or from stdin when name is
+// empty or "-". A single trailing newline is removed.
+func readSecret(name string, stdin io.Reader) (string, error) {
+	r := stdin
+	if name != "" && name != "-" {
+		f, err := os.Open(name)
+		if err != nil {
+			return "", err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return "", fmt.Errorf("failed to read secret: %w", err)
+	}
+	s := strings.TrimSuffix(string(data), "\n")
+	return strings.TrimSuffix(s, "\r"), nil
+}
+
+// exitCode maps an error returned by the client to the process exit code.
+func exitCode(err error) int {
+	var apiErr *apiError
+	if !errors.As(err, &apiErr) {
+		return exitError
+	}
+	switch apiErr.Code {
+	case "not_found", "too_many_attempts":
+		return exitNotFound
+	case "invalid_id":
+		return exitInvalidID
+	case "passphrase_required", "wrong_passphrase":
+		return exitPassphrase
+	case "invalid_request", "empty_secret", "invalid_ttl", "invalid_views", "secret_too_large", "file_too_large":
+		return exitUsage
+	default:
+		return exitError
+	}
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newFakeServer returns a test server implementing the create and reveal API
+// endpoints backed by an in-memory map.
+func newFakeServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	secrets := map[string]revealResponse{}
+	writeError := func(w http.ResponseWriter, status int, code string) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"error": map[string]string{"code": code, "message": code},
+		})
+	}
+
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		if r.URL.Path == "/api/v1/secrets" {
+			var req createRequest
+			var revealed revealResponse
+			if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+				f, hdr, err := r.FormFile("file")
+				if err != nil {
+					writeError(w, http.StatusBadRequest, "invalid_request")
+					return
+				}
+				data, _ := io.ReadAll(f)
+				revealed.File = &fileResponse{Filename: hdr.Filename, ContentType: "text/plain", Data: data}
+				req.TTL = r.FormValue("ttl")
+			} else {
+				if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+					writeError(w, http.StatusBadRequest, "invalid_request")
+					return
+				}
+				revealed.Secret = req.Secret
+			}
+			if req.TTL == "bad" {
+				writeError(w, http.StatusBadRequest, "invalid_ttl")
+				return
+			}
+			if req.Views > 10 {
+				writeError(w, http.StatusBadRequest, "invalid_views")
+				return
+			}
+			id := "secret" + string(rune('a'+len(secrets)))
+			secrets[id] = revealed
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(createResponse{ID: id, URL: srv.URL + "/get/" + id})
+			return
+		}
+		id, ok := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, "/api/v1/secrets/"), "/reveal")
+		switch {
+		case !ok:
+			http.NotFound(w, r)
+		case id == "malformed":
+			writeError(w, http.StatusBadRequest, "invalid_id")
+		case id == "wrongkey":
+			// The server does not tell a wrong ID apart from a missing secret.
+			writeError(w, http.StatusNotFound, "not_found")
+		case id == "protected":
+			var req revealRequest
+			json.NewDecoder(r.Body).Decode(&req)
+			switch req.Passphrase {
+			case "":
+				writeError(w, http.StatusForbidden, "passphrase_required")
+			case "pw":
+				json.NewEncoder(w).Encode(revealResponse{Secret: "protected secret"})
+			default:
+				writeError(w, http.StatusForbidden, "wrong_passphrase")
+			}
+		case id == "browser":
+			json.NewEncoder(w).Encode(revealResponse{Secret: browserCiphertext, ClientEncrypted: true})
+		case secrets[id].Secret == "" && secrets[id].File == nil:
+			writeError(w, http.StatusNotFound, "not_found")
+		default:
+			json.NewEncoder(w).Encode(secrets[id])
+			delete(secrets, id)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func runCmd(stdin string, args ...string) (code int, stdout, stderr string) {
+	var out, errOut bytes.Buffer
+	code = run(args, strings.NewReader(stdin), &out, &errOut)
+	return code, out.String(), errOut.String()
+}
+
+func TestRun_CreateAndReveal(t *testing.T) {
+	srv := newFakeServer(t)
+
+	code, out, errOut := runCmd("s3cret\n", "create", "-server", srv.URL, "-ttl", "1h")
+	if code != exitOK {
+		t.Fatalf("create: exit code %d, stderr: %s", code, errOut)
+	}
+	shareURL := strings.TrimSpace(out)
+	if !strings.HasPrefix(shareURL, srv.URL+"/get/") {
+		t.Fatalf("create: printed %q, want a share URL", out)
+	}
+
+	code, out, errOut = runCmd("", "reveal", shareURL)
+	if code != exitOK {
+		t.Fatalf("reveal: exit code %d, stderr: %s", code, errOut)
+	}
+	if out != "s3cret\n" {
+		t.Errorf("reveal: printed %q, want %q", out, "s3cret\n")
+	}
+
+	code, _, _ = runCmd("", "reveal", shareURL)
+	if code != exitNotFound {
+		t.Errorf("reveal burned secret: exit code %d, want %d", code, exitNotFound)
+	}
+}
+
+func TestRun_CreateFromFile(t *testing.T) {
+	srv := newFakeServer(t)
+	path := filepath.Join(t.TempDir(), "secret.txt")
+	if err := os.WriteFile(path, []byte("from file"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	code, out, errOut := runCmd("", "create", "-server", srv.URL, path)
+	if code != exitOK {
+		t.Fatalf("create: exit code %d, stderr: %s", code, errOut)
+	}
+
+	id := strings.TrimPrefix(strings.TrimSpace(out), srv.URL+"/get/")
+	code, out, _ = runCmd("", "reveal", "-server", srv.URL, id)
+	if code != exitOK || out != "from file\n" {
+		t.Errorf("reveal by ID: exit code %d, printed %q", code, out)
+	}
+}
+
+func TestRun_AttachFile(t *testing.T) {
+	srv := newFakeServer(t)
+	dir := t.TempDir()
+	path := filepath.Join(dir, "notes.txt")
+	if err := os.WriteFile(path, []byte("file contents\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	code, out, errOut := runCmd("", "create", "-server", srv.URL, "-attach", "-ttl", "1h", path)
+	if code != exitOK {
+		t.Fatalf("create: exit code %d, stderr: %s", code, errOut)
+	}
+
+	outPath := filepath.Join(dir, "revealed.txt")
+	code, out, errOut = runCmd("", "reveal", "-o", outPath, strings.TrimSpace(out))
+	if code != exitOK {
+		t.Fatalf("reveal: exit code %d, stderr: %s", code, errOut)
+	}
+	if out != "" {
+		t.Errorf("reveal -o printed %q to stdout", out)
+	}
+	if !strings.Contains(errOut, `"notes.txt"`) {
+		t.Errorf("reveal stderr %q does not name the file", errOut)
+	}
+	got, err := os.ReadFile(outPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "file contents\n" {
+		t.Errorf("revealed file contains %q, want %q", got, "file contents\n")
+	}
+}
+
+// browserCiphertext and browserKey are a secret encrypted the way the browser
+// does, revealed by the fake server under the ID "browser".
+const (
+	browserCiphertext = "AAECAwQFBgcICQoLJXC5bLaAsDv+JPT51J1Qu1OqXICVzi+TcwqyVN55"
+	browserKey        = "AAECAwQFBgcICQoLDA0ODxAREhMUFRYXGBkaGxwdHh8"
+)
+
+func TestRun_RevealBrowserEncrypted(t *testing.T) {
+	srv := newFakeServer(t)
+
+	code, out, errOut := runCmd("", "reveal", srv.URL+"/get/browser#"+browserKey)
+	if code != exitOK {
+		t.Fatalf("reveal: exit code %d, stderr: %s", code, errOut)
+	}
+	if out != "browser secret\n" {
+		t.Errorf("reveal: printed %q, want %q", out, "browser secret\n")
+	}
+}
+
+func TestRun_ExitCodes(t *testing.T) {
+	srv := newFakeServer(t)
+
+	tests := []struct {
+		name  string
+		stdin string
+		args  []string
+		want  int
+	}{
+		{"no command", "", nil, exitUsage},
+		{"unknown command", "", []string{"burn"}, exitUsage},
+		{"empty secret", "", []string{"create", "-server", srv.URL}, exitUsage},
+		{"invalid ttl", "x", []string{"create", "-server", srv.URL, "-ttl", "bad"}, exitUsage},
+		{"too many views", "x", []string{"create", "-server", srv.URL, "-views", "11"}, exitUsage},
+		{"missing file", "", []string{"create", "-server", srv.URL, "does-not-exist"}, exitError},
+		{"attach without file", "x", []string{"create", "-server", srv.URL, "-attach"}, exitUsage},
+		{"attach missing file", "", []string{"create", "-server", srv.URL, "-attach", "does-not-exist"}, exitError},
+		{"reveal without ID", "", []string{"reveal", "-server", srv.URL}, exitUsage},
+		{"not found", "", []string{"reveal", srv.URL + "/get/missing"}, exitNotFound},
+		{"malformed ID", "", []string{"reveal", srv.URL + "/get/malformed"}, exitInvalidID},
+		{"URL without ID", "", []string{"reveal", srv.URL + "/other"}, exitInvalidID},
+		{"wrong key", "", []string{"reveal", srv.URL + "/get/wrongkey"}, exitNotFound},
+		{"browser secret without key", "", []string{"reveal", srv.URL + "/get/browser"}, exitDecryptionFail},
+		{"browser secret with wrong key", "", []string{"reveal", srv.URL + "/get/browser#" + strings.Repeat("A", 43)}, exitDecryptionFail},
+		{"passphrase required", "", []string{"reveal", srv.URL + "/get/protected"}, exitPassphrase},
+		{"wrong passphrase", "", []string{"reveal", "-passphrase", "nope", srv.URL + "/get/protected"}, exitPassphrase},
+		{"correct passphrase", "", []string{"reveal", "-passphrase", "pw", srv.URL + "/get/protected"}, exitOK},
+		{"server unreachable", "", []string{"reveal", "http://127.0.0.1:1/get/abc"}, exitError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _, errOut := runCmd(tt.stdin, tt.args...)
+			if code != tt.want {
+				t.Errorf("exit code %d, want %d (stderr: %s)", code, tt.want, errOut)
+			}
+		})
+	}
+}
+
+func TestParseSecretRef(t *testing.T) {
+	tests := []struct {
+		ref      string
+		wantBase string
+		wantID   string
+		wantKey  string
+		wantErr  bool
+	}{
+		{"abc123", "", "abc123", "", false},
+		{"abc123#k3y", "", "abc123", "k3y", false},
+		{"https://grb.example.com/get/abc123", "https://grb.example.com", "abc123", "", false},
+		{"https://grb.example.com/get/abc123#k3y-_", "https://grb.example.com", "abc123", "k3y-_", false},
+		{"http://host:8080/burn/get/abc123", "http://host:8080/burn", "abc123", "", false},
+		{"https://grb.example.com/", "", "", "", true},
+		{"https://grb.example.com/get/", "", "", "", true},
+		{"https://grb.example.com/get/a/b", "", "", "", true},
+		{"/get/abc123", "", "", "", true},
+	}
+	for _, tt := range tests {
+		base, id, key, err := parseSecretRef(tt.ref)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseSecretRef(%q) error = %v, wantErr %v", tt.ref, err, tt.wantErr)
+			continue
+		}
+		if base != tt.wantBase || id != tt.wantID || key != tt.wantKey {
+			t.Errorf("parseSecretRef(%q) = %q, %q, %q, want %q, %q, %q", tt.ref, base, id, key, tt.wantBase, tt.wantID, tt.wantKey)
+		}
+	}
+}
@@ -8,29 +8,18 @@ import (
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/rand"
+	"encoding/base64"
 	"errors"
 	"fmt"
 	"math/big"
-
-	"golang.org/x/crypto/scrypt"
 )
 
 const (
-	// KeyLength is the length of the database key component in the ID (8 chars).
-	KeyLength = 8
-	// PasswordLength is the length of the password component in the ID (32 chars).
-	PasswordLength = 32
-	// NonceLength is the length of the nonce component in the ID (16 chars).
-	NonceLength = 16
-	// SaltLength is the length of the salt component in the ID (16 chars).
-	SaltLength = 16
-	// FullIDLength is the total length of a complete ID (72 chars).
-	FullIDLength = KeyLength + PasswordLength + NonceLength + SaltLength
-
 	aesKeySize   = 32
 	gcmNonceSize = 12
 
-	// scrypt parameters per OWASP recommendations (2^17 minimum for N)
+	// scrypt parameters of DefaultKDF per OWASP recommendations (2^17
+	// minimum for N)
 	scryptN = 131072
 	scryptR = 8
 	scryptP = 1
@@ -39,82 +28,43 @@ const (
 const base62Alphabet = "0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
 
 var (
-	// ErrInvalidIDLength is returned when the ID length is not 72 characters.
-	ErrInvalidIDLength = errors.New("invalid ID length: expected 72 characters")
-	// ErrInvalidIDCharacters is returned when the ID contains non-base62 characters.
-	ErrInvalidIDCharacters = errors.New("invalid ID: contains non-base62 characters")
 	// ErrInvalidCiphertext is returned when decryption fails due to invalid data.
 	ErrInvalidCiphertext = errors.New("invalid ciphertext")
 	// ErrEmptyPlaintext is returned when attempting to encrypt empty data.
 	ErrEmptyPlaintext = errors.New("plaintext cannot be empty")
 	// ErrDecryptionFailed is returned when authenticated decryption fails.
 	ErrDecryptionFailed = errors.New("decryption failed: authentication error")
+	// ErrInvalidClientKey is returned when a client-side encryption key is malformed.
+	ErrInvalidClientKey = errors.New("invalid client key: expected 32 base64url encoded bytes")
 )
 
-// GenerateID generates a new random ID containing all encryption parameters.
-// Returns the individual components and the full 72-character ID.
-//
-// The ID format is: [8-char Key] + [32-char Password] + [16-char Nonce] + [16-char Salt]
-//
-//   - key: Used as database lookup key (not secret)
-//   - password: Used with scrypt to derive the AES encryption key (secret)
-//   - nonce: Nonce for AES-GCM (ensures non-deterministic encryption)
-//   - salt: Salt for scrypt key derivation (adds additional randomness)
-func GenerateID() (key, password, nonce, salt, fullID string, err error) {
-	key, err = generateRandomBase62(KeyLength)
-	if err != nil {
-		return "", "", "", "", "", fmt.Errorf("failed to generate key: %w", err)
-	}
-
-	password, err = generateRandomBase62(PasswordLength)
-	if err != nil {
-		return "", "", "", "", "", fmt.Errorf("failed to generate password: %w", err)
-	}
-
-	nonce, err = generateRandomBase62(NonceLength)
-	if err != nil {
-		return "", "", "", "", "", fmt.Errorf("failed to generate nonce: %w", err)
-	}
-
-	salt, err = generateRandomBase62(SaltLength)
-	if err != nil {
-		return "", "", "", "", "", fmt.Errorf("failed to generate salt: %w", err)
-	}
-
-	fullID = key + password + nonce + salt
-	return key, password, nonce, salt, fullID, nil
+// Encrypt encrypts plaintext using AES-256-GCM with the given password, nonce, and salt.
+// The password and salt are used with scrypt to derive a 32-byte AES key.
+// AES-GCM provides authenticated encryption (confidentiality + integrity).
+func Encrypt(plaintext, password, nonce, salt string) ([]byte, error) {
+	return EncryptWithPassphrase(plaintext, password, "", nonce, salt)
 }
 
-// ParseID splits a 72-character ID into its components.
-// Returns an error if the ID is invalid.
-func ParseID(fullID string) (key, password, nonce, salt string, err error) {
-	if len(fullID) != FullIDLength {
-		return "", "", "", "", ErrInvalidIDLength
-	}
-
-	for _, c := range fullID {
-		if !isBase62Char(byte(c)) {
-			return "", "", "", "", ErrInvalidIDCharacters
-		}
-	}
-
-	key = fullID[0:KeyLength]
-	password = fullID[KeyLength : KeyLength+PasswordLength]
-	nonce = fullID[KeyLength+PasswordLength : KeyLength+PasswordLength+NonceLength]
-	salt = fullID[KeyLength+PasswordLength+NonceLength : FullIDLength]
+// EncryptWithPassphrase is like Encrypt, but additionally mixes a user chosen
+// passphrase into the key derivation, so the ID alone cannot decrypt the
+// ciphertext. An empty passphrase is equivalent to Encrypt.
+func EncryptWithPassphrase(plaintext, password, passphrase, nonce, salt string) ([]byte, error) {
+	return EncryptBytes([]byte(plaintext), password, passphrase, nonce, salt)
+}
 
-	return key, password, nonce, salt, nil
+// EncryptBytes is the byte-oriented form of EncryptWithPassphrase, for binary
+// data such as file contents.
+func EncryptBytes(plaintext []byte, password, passphrase, nonce, salt string) ([]byte, error) {
+	return encryptBytes(plaintext, password, passphrase, nonce, salt, DefaultKDF)
 }
 
-// Encrypt encrypts plaintext using AES-256-GCM with the given password, nonce, and salt.
-// The password and salt are used with scrypt to derive a 32-byte AES key.
-// AES-GCM provides authenticated encryption (confidentiality + integrity).
-func Encrypt(plaintext, password, nonce, salt string) ([]byte, error) {
+// encryptBytes is EncryptBytes with the key derived using kdf.
+func encryptBytes(plaintext []byte, password, passphrase, nonce, salt string, kdf KDFParams) ([]byte, error) {
 	if len(plaintext) == 0 {
 		return nil, ErrEmptyPlaintext
 	}
 
-	aesKey, err := deriveKey(password, salt)
+	aesKey, err := kdf.deriveKey(password, passphrase, salt)
 	if err != nil {
 		return nil, fmt.Errorf("failed to derive key: %w", err)
 	}
@@ -135,7 +85,7 @@ func Encrypt(plaintext, password, nonce, salt string) ([]byte, error) {
 	}
 	nonceBytes = nonceBytes[:gcmNonceSize]
 
-	ciphertext := aesGCM.Seal(nil, nonceBytes, []byte(plaintext), nil)
+	ciphertext := aesGCM.Seal(nil, nonceBytes, plaintext, nil)
 
 	return ciphertext, nil
 }
@@ -144,41 +94,57 @@ func Encrypt(plaintext, password, nonce, salt string) ([]byte, error) {
 // The password and salt are used with scrypt to derive the AES key.
 // Returns an error if authentication fails (tampered ciphertext).
 func Decrypt(ciphertext []byte, password, nonce, salt string) (string, error) {
+	return DecryptWithPassphrase(ciphertext, password, "", nonce, salt)
+}
+
+// DecryptWithPassphrase decrypts ciphertext produced by EncryptWithPassphrase.
+// A wrong passphrase fails authentication in the same way as a wrong password.
+func DecryptWithPassphrase(ciphertext []byte, password, passphrase, nonce, salt string) (string, error) {
+	plaintext, err := DecryptBytes(ciphertext, password, passphrase, nonce, salt)
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+// DecryptBytes decrypts ciphertext produced by EncryptBytes.
+func DecryptBytes(ciphertext []byte, password, passphrase, nonce, salt string) ([]byte, error) {
+	return decryptBytes(ciphertext, password, passphrase, nonce, salt, DefaultKDF)
+}
+
+// decryptBytes is DecryptBytes with the key derived using kdf.
+func decryptBytes(ciphertext []byte, password, passphrase, nonce, salt string, kdf KDFParams) ([]byte, error) {
 	if len(ciphertext) == 0 {
-		return "", ErrInvalidCiphertext
+		return nil, ErrInvalidCiphertext
 	}
 
-	aesKey, err := deriveKey(password, salt)
+	aesKey, err := kdf.deriveKey(password, passphrase, salt)
 	if err != nil {
-		return "", fmt.Errorf("failed to derive key: %w", err)
+		return nil, fmt.Errorf("failed to derive key: %w", err)
 	}
 
 	block, err := aes.NewCipher(aesKey)
 	if err != nil {
-		return "", fmt.Errorf("failed to create cipher: %w", err)
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
 	}
 
 	aesGCM, err := cipher.NewGCM(block)
 	if err != nil {
-		return "", fmt.Errorf("failed to create GCM: %w", err)
+		return nil, fmt.Errorf("failed to create GCM: %w", err)
 	}
 
 	nonceBytes := []byte(nonce)
 	if len(nonceBytes) < gcmNonceSize {
-		return "", fmt.Errorf("nonce too short: got %d bytes, need %d", len(nonceBytes), gcmNonceSize)
+		return nil, fmt.Errorf("nonce too short: got %d bytes, need %d", len(nonceBytes), gcmNonceSize)
 	}
 	nonceBytes = nonceBytes[:gcmNonceSize]
 
 	plaintext, err := aesGCM.Open(nil, nonceBytes, ciphertext, nil)
 	if err != nil {
-		return "", ErrDecryptionFailed
+		return nil, ErrDecryptionFailed
 	}
 
-	return string(plaintext), nil
-}
-
-func deriveKey(password, salt string) ([]byte, error) {
-	return scrypt.Key([]byte(password), []byte(salt), scryptN, scryptR, scryptP, aesKeySize)
+	return plaintext, nil
 }
 
 func generateRandomBase62(length int) (string, error) {
@@ -237,15 +203,52 @@ func isBase62Char(c byte) bool {
 		(c >= 'A' && c <= 'Z')
 }
 
-// ValidateID validates that an ID is well-formed (correct length and characters).
-func ValidateID(id string) bool {
-	if len(id) != FullIDLength {
-		return false
+// ValidateClientCiphertext reports whether ciphertext is well-formed output of
+// the browser-side encryption: the base64 encoding of a 12-byte AES-GCM nonce
+// followed by the sealed data and its 16-byte tag. The content itself cannot be
+// checked without the key, which never reaches the server.
+func ValidateClientCiphertext(ciphertext string) bool {
+	data, err := base64.StdEncoding.DecodeString(ciphertext)
+	return err == nil && len(data) > gcmNonceSize+16
+}
+
+// ClientPlaintextSize returns the size in bytes of the plaintext that client
+// ciphertext decrypts to, or 0 if the ciphertext is malformed.
+func ClientPlaintextSize(ciphertext string) int {
+	data, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil {
+		return 0
 	}
-	for _, c := range id {
-		if !isBase62Char(byte(c)) {
-			return false
-		}
+	return max(len(data)-gcmNonceSize-16, 0)
+}
+
+// DecryptClient decrypts ciphertext produced by the browser-side encryption
+// with the base64url encoded AES-256 key taken from the share URL fragment.
+func DecryptClient(ciphertext, key string) (string, error) {
+	aesKey, err := base64.RawURLEncoding.DecodeString(key)
+	if err != nil || len(aesKey) != aesKeySize {
+		return "", ErrInvalidClientKey
+	}
+
+	data, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil || len(data) <= gcmNonceSize {
+		return "", ErrInvalidCiphertext
+	}
+
+	block, err := aes.NewCipher(aesKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to create cipher: %w", err)
+	}
+
+	aesGCM, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", fmt.Errorf("failed to create GCM: %w", err)
 	}
-	return true
+
+	plaintext, err := aesGCM.Open(nil, data[:gcmNonceSize], data[gcmNonceSize:], nil)
+	if err != nil {
+		return "", ErrDecryptionFailed
+	}
+
+	return string(plaintext), nil
 }
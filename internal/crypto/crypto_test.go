@@ -2,163 +2,14 @@ package crypto
 
 import (
 	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
 	"strings"
 	"testing"
 )
 
-func TestGenerateID(t *testing.T) {
-	key, password, nonce, salt, fullID, err := GenerateID()
-
-	if err != nil {
-		t.Fatalf("GenerateID() returned error: %v", err)
-	}
-
-	if len(key) != KeyLength {
-		t.Errorf("key length = %d, want %d", len(key), KeyLength)
-	}
-
-	if len(password) != PasswordLength {
-		t.Errorf("password length = %d, want %d", len(password), PasswordLength)
-	}
-
-	if len(nonce) != NonceLength {
-		t.Errorf("nonce length = %d, want %d", len(nonce), NonceLength)
-	}
-
-	if len(salt) != SaltLength {
-		t.Errorf("salt length = %d, want %d", len(salt), SaltLength)
-	}
-
-	if len(fullID) != FullIDLength {
-		t.Errorf("fullID length = %d, want %d", len(fullID), FullIDLength)
-	}
-
-	expectedFullID := key + password + nonce + salt
-	if fullID != expectedFullID {
-		t.Errorf("fullID = %s, want %s", fullID, expectedFullID)
-	}
-
-	for i, c := range fullID {
-		if !isBase62Char(byte(c)) {
-			t.Errorf("fullID contains invalid character at position %d: %c", i, c)
-		}
-	}
-}
-
-func TestGenerateID_Uniqueness(t *testing.T) {
-	ids := make(map[string]bool)
-	iterations := 100
-
-	for i := 0; i < iterations; i++ {
-		_, _, _, _, fullID, err := GenerateID()
-		if err != nil {
-			t.Fatalf("GenerateID() returned error: %v", err)
-		}
-
-		if ids[fullID] {
-			t.Errorf("duplicate ID generated: %s", fullID)
-		}
-		ids[fullID] = true
-	}
-}
-
-func TestParseID(t *testing.T) {
-	tests := []struct {
-		name      string
-		fullID    string
-		wantKey   string
-		wantPass  string
-		wantNonce string
-		wantSalt  string
-		wantErr   error
-	}{
-		{
-			name:      "valid ID",
-			fullID:    "12345678" + strings.Repeat("a", 32) + strings.Repeat("b", 16) + strings.Repeat("c", 16),
-			wantKey:   "12345678",
-			wantPass:  strings.Repeat("a", 32),
-			wantNonce: strings.Repeat("b", 16),
-			wantSalt:  strings.Repeat("c", 16),
-			wantErr:   nil,
-		},
-		{
-			name:    "too short",
-			fullID:  "short",
-			wantErr: ErrInvalidIDLength,
-		},
-		{
-			name:    "too long",
-			fullID:  strings.Repeat("a", 73),
-			wantErr: ErrInvalidIDLength,
-		},
-		{
-			name:    "invalid characters",
-			fullID:  strings.Repeat("!", 72),
-			wantErr: ErrInvalidIDCharacters,
-		},
-		{
-			name:    "contains space",
-			fullID:  strings.Repeat("a", 35) + " " + strings.Repeat("b", 36),
-			wantErr: ErrInvalidIDCharacters,
-		},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			key, password, nonce, salt, err := ParseID(tt.fullID)
-
-			if tt.wantErr != nil {
-				if err != tt.wantErr {
-					t.Errorf("ParseID() error = %v, want %v", err, tt.wantErr)
-				}
-				return
-			}
-
-			if err != nil {
-				t.Fatalf("ParseID() unexpected error: %v", err)
-			}
-
-			if key != tt.wantKey {
-				t.Errorf("key = %s, want %s", key, tt.wantKey)
-			}
-			if password != tt.wantPass {
-				t.Errorf("password = %s, want %s", password, tt.wantPass)
-			}
-			if nonce != tt.wantNonce {
-				t.Errorf("nonce = %s, want %s", nonce, tt.wantNonce)
-			}
-			if salt != tt.wantSalt {
-				t.Errorf("salt = %s, want %s", salt, tt.wantSalt)
-			}
-		})
-	}
-}
-
-func TestParseID_RoundTrip(t *testing.T) {
-	key, password, nonce, salt, fullID, err := GenerateID()
-	if err != nil {
-		t.Fatalf("GenerateID() error: %v", err)
-	}
-
-	parsedKey, parsedPassword, parsedNonce, parsedSalt, err := ParseID(fullID)
-	if err != nil {
-		t.Fatalf("ParseID() error: %v", err)
-	}
-
-	if parsedKey != key {
-		t.Errorf("parsed key = %s, want %s", parsedKey, key)
-	}
-	if parsedPassword != password {
-		t.Errorf("parsed password = %s, want %s", parsedPassword, password)
-	}
-	if parsedNonce != nonce {
-		t.Errorf("parsed nonce = %s, want %s", parsedNonce, nonce)
-	}
-	if parsedSalt != salt {
-		t.Errorf("parsed salt = %s, want %s", parsedSalt, salt)
-	}
-}
-
 func TestEncryptDecrypt_RoundTrip(t *testing.T) {
 	tests := []struct {
 		name      string
@@ -177,10 +28,11 @@ func TestEncryptDecrypt_RoundTrip(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			_, password, nonce, salt, _, err := GenerateID()
+			id, err := GenerateID()
 			if err != nil {
 				t.Fatalf("GenerateID() error: %v", err)
 			}
+			password, nonce, salt := id.Password, id.Nonce, id.Salt
 
 			ciphertext, err := Encrypt(tt.plaintext, password, nonce, salt)
 			if err != nil {
@@ -200,10 +52,11 @@ func TestEncryptDecrypt_RoundTrip(t *testing.T) {
 }
 
 func TestEncrypt_EmptyPlaintext(t *testing.T) {
-	_, password, nonce, salt, _, err := GenerateID()
+	id, err := GenerateID()
 	if err != nil {
 		t.Fatalf("GenerateID() error: %v", err)
 	}
+	password, nonce, salt := id.Password, id.Nonce, id.Salt
 
 	_, err = Encrypt("", password, nonce, salt)
 	if err != ErrEmptyPlaintext {
@@ -216,10 +69,11 @@ func TestEncrypt_NonDeterministic(t *testing.T) {
 	ciphertexts := make([][]byte, 10)
 
 	for i := 0; i < 10; i++ {
-		_, password, nonce, salt, _, err := GenerateID()
+		id, err := GenerateID()
 		if err != nil {
 			t.Fatalf("GenerateID() error: %v", err)
 		}
+		password, nonce, salt := id.Password, id.Nonce, id.Salt
 
 		ciphertext, err := Encrypt(plaintext, password, nonce, salt)
 		if err != nil {
@@ -238,10 +92,11 @@ func TestEncrypt_NonDeterministic(t *testing.T) {
 }
 
 func TestDecrypt_InvalidCiphertext(t *testing.T) {
-	_, password, nonce, salt, _, err := GenerateID()
+	id, err := GenerateID()
 	if err != nil {
 		t.Fatalf("GenerateID() error: %v", err)
 	}
+	password, nonce, salt := id.Password, id.Nonce, id.Salt
 
 	tests := []struct {
 		name       string
@@ -264,15 +119,17 @@ func TestDecrypt_InvalidCiphertext(t *testing.T) {
 }
 
 func TestDecrypt_WrongParameters(t *testing.T) {
-	_, password1, nonce1, salt1, _, err := GenerateID()
+	id1, err := GenerateID()
 	if err != nil {
 		t.Fatalf("GenerateID() error: %v", err)
 	}
+	password1, nonce1, salt1 := id1.Password, id1.Nonce, id1.Salt
 
-	_, password2, nonce2, salt2, _, err := GenerateID()
+	id2, err := GenerateID()
 	if err != nil {
 		t.Fatalf("GenerateID() error: %v", err)
 	}
+	password2, nonce2, salt2 := id2.Password, id2.Nonce, id2.Salt
 
 	plaintext := "test secret"
 	ciphertext, err := Encrypt(plaintext, password1, nonce1, salt1)
@@ -303,10 +160,11 @@ func TestDecrypt_WrongParameters(t *testing.T) {
 }
 
 func TestDecrypt_TamperedCiphertext(t *testing.T) {
-	_, password, nonce, salt, _, err := GenerateID()
+	id, err := GenerateID()
 	if err != nil {
 		t.Fatalf("GenerateID() error: %v", err)
 	}
+	password, nonce, salt := id.Password, id.Nonce, id.Salt
 
 	plaintext := "test secret"
 	ciphertext, err := Encrypt(plaintext, password, nonce, salt)
@@ -324,45 +182,6 @@ func TestDecrypt_TamperedCiphertext(t *testing.T) {
 	}
 }
 
-func TestValidateID(t *testing.T) {
-	tests := []struct {
-		name string
-		id   string
-		want bool
-	}{
-		{"valid all lowercase", strings.Repeat("a", 72), true},
-		{"valid all uppercase", strings.Repeat("A", 72), true},
-		{"valid all digits", strings.Repeat("0", 72), true},
-		{"valid mixed", "12345678" + strings.Repeat("aB", 32), true},
-		{"too short", strings.Repeat("a", 71), false},
-		{"too long", strings.Repeat("a", 73), false},
-		{"empty", "", false},
-		{"contains space", strings.Repeat("a", 35) + " " + strings.Repeat("a", 36), false},
-		{"contains special char", strings.Repeat("a", 35) + "!" + strings.Repeat("a", 36), false},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			if got := ValidateID(tt.id); got != tt.want {
-				t.Errorf("ValidateID() = %v, want %v", got, tt.want)
-			}
-		})
-	}
-}
-
-func TestValidateID_GeneratedID(t *testing.T) {
-	for i := 0; i < 100; i++ {
-		_, _, _, _, fullID, err := GenerateID()
-		if err != nil {
-			t.Fatalf("GenerateID() error: %v", err)
-		}
-
-		if !ValidateID(fullID) {
-			t.Errorf("ValidateID() returned false for generated ID: %s", fullID)
-		}
-	}
-}
-
 func TestBase62Encode(t *testing.T) {
 	result := base62Encode([]byte{})
 	if result != "" {
@@ -397,11 +216,86 @@ func TestIsBase62Char(t *testing.T) {
 	}
 }
 
+func TestEncryptDecrypt_Passphrase(t *testing.T) {
+	id, err := GenerateID()
+	if err != nil {
+		t.Fatalf("GenerateID() error: %v", err)
+	}
+	password, nonce, salt := id.Password, id.Nonce, id.Salt
+
+	ciphertext, err := EncryptWithPassphrase("high value", password, "correct horse", nonce, salt)
+	if err != nil {
+		t.Fatalf("EncryptWithPassphrase() error: %v", err)
+	}
+
+	plaintext, err := DecryptWithPassphrase(ciphertext, password, "correct horse", nonce, salt)
+	if err != nil {
+		t.Fatalf("DecryptWithPassphrase() error: %v", err)
+	}
+	if plaintext != "high value" {
+		t.Errorf("DecryptWithPassphrase() = %q, want %q", plaintext, "high value")
+	}
+
+	if _, err := DecryptWithPassphrase(ciphertext, password, "wrong horse", nonce, salt); err != ErrDecryptionFailed {
+		t.Errorf("DecryptWithPassphrase() with wrong passphrase error = %v, want %v", err, ErrDecryptionFailed)
+	}
+	if _, err := Decrypt(ciphertext, password, nonce, salt); err != ErrDecryptionFailed {
+		t.Errorf("Decrypt() without passphrase error = %v, want %v", err, ErrDecryptionFailed)
+	}
+}
+
+func TestEncryptWithPassphrase_EmptyMatchesEncrypt(t *testing.T) {
+	id, err := GenerateID()
+	if err != nil {
+		t.Fatalf("GenerateID() error: %v", err)
+	}
+	password, nonce, salt := id.Password, id.Nonce, id.Salt
+
+	ciphertext, err := Encrypt("compatible", password, nonce, salt)
+	if err != nil {
+		t.Fatalf("Encrypt() error: %v", err)
+	}
+	withEmpty, err := EncryptWithPassphrase("compatible", password, "", nonce, salt)
+	if err != nil {
+		t.Fatalf("EncryptWithPassphrase() error: %v", err)
+	}
+	if !bytes.Equal(ciphertext, withEmpty) {
+		t.Error("an empty passphrase must derive the same key as Encrypt")
+	}
+}
+
+func TestEncryptDecryptBytes_Binary(t *testing.T) {
+	id, err := GenerateID()
+	if err != nil {
+		t.Fatalf("GenerateID() error: %v", err)
+	}
+	password, nonce, salt := id.Password, id.Nonce, id.Salt
+
+	data := []byte{0x00, 0xff, 0x10, 0x00, 0x80, 0x7f}
+	ciphertext, err := EncryptBytes(data, password, "", nonce, salt)
+	if err != nil {
+		t.Fatalf("EncryptBytes() error: %v", err)
+	}
+
+	plaintext, err := DecryptBytes(ciphertext, password, "", nonce, salt)
+	if err != nil {
+		t.Fatalf("DecryptBytes() error: %v", err)
+	}
+	if !bytes.Equal(plaintext, data) {
+		t.Errorf("DecryptBytes() = %x, want %x", plaintext, data)
+	}
+
+	if _, err := EncryptBytes(nil, password, "", nonce, salt); err != ErrEmptyPlaintext {
+		t.Errorf("EncryptBytes(nil) error = %v, want %v", err, ErrEmptyPlaintext)
+	}
+}
+
 func TestEncrypt_ShortNonce(t *testing.T) {
-	_, password, _, salt, _, err := GenerateID()
+	id, err := GenerateID()
 	if err != nil {
 		t.Fatalf("GenerateID() error: %v", err)
 	}
+	password, salt := id.Password, id.Salt
 
 	_, err = Encrypt("test", password, "short", salt)
 	if err == nil {
@@ -410,10 +304,11 @@ func TestEncrypt_ShortNonce(t *testing.T) {
 }
 
 func TestDecrypt_ShortNonce(t *testing.T) {
-	_, password, _, salt, _, err := GenerateID()
+	id, err := GenerateID()
 	if err != nil {
 		t.Fatalf("GenerateID() error: %v", err)
 	}
+	password, salt := id.Password, id.Salt
 
 	_, err = Decrypt(make([]byte, 32), password, "short", salt)
 	if err == nil {
@@ -421,9 +316,96 @@ func TestDecrypt_ShortNonce(t *testing.T) {
 	}
 }
 
+// encryptClient encrypts plaintext the way the browser-side encryption does,
+// returning the base64 ciphertext and base64url key.
+func encryptClient(t *testing.T, plaintext string) (ciphertext, key string) {
+	t.Helper()
+	aesKey := make([]byte, aesKeySize)
+	nonce := make([]byte, gcmNonceSize)
+	if _, err := rand.Read(aesKey); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rand.Read(nonce); err != nil {
+		t.Fatal(err)
+	}
+	block, err := aes.NewCipher(aesKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	aesGCM, err := cipher.NewGCM(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed := aesGCM.Seal(nonce, nonce, []byte(plaintext), nil)
+	return base64.StdEncoding.EncodeToString(sealed), base64.RawURLEncoding.EncodeToString(aesKey)
+}
+
+func TestDecryptClient(t *testing.T) {
+	ciphertext, key := encryptClient(t, "from the browser")
+
+	if !ValidateClientCiphertext(ciphertext) {
+		t.Errorf("ValidateClientCiphertext(%q) = false, want true", ciphertext)
+	}
+	plaintext, err := DecryptClient(ciphertext, key)
+	if err != nil {
+		t.Fatalf("DecryptClient() error: %v", err)
+	}
+	if plaintext != "from the browser" {
+		t.Errorf("DecryptClient() = %q, want %q", plaintext, "from the browser")
+	}
+
+	_, otherKey := encryptClient(t, "other")
+	if _, err := DecryptClient(ciphertext, otherKey); err != ErrDecryptionFailed {
+		t.Errorf("DecryptClient() with wrong key error = %v, want %v", err, ErrDecryptionFailed)
+	}
+	if _, err := DecryptClient(ciphertext, "short"); err != ErrInvalidClientKey {
+		t.Errorf("DecryptClient() with short key error = %v, want %v", err, ErrInvalidClientKey)
+	}
+	if _, err := DecryptClient("not base64!", key); err != ErrInvalidCiphertext {
+		t.Errorf("DecryptClient() with invalid ciphertext error = %v, want %v", err, ErrInvalidCiphertext)
+	}
+}
+
+func TestValidateClientCiphertext(t *testing.T) {
+	tests := []struct {
+		name       string
+		ciphertext string
+		want       bool
+	}{
+		{"plain text", "hunter2", false},
+		{"empty", "", false},
+		{"too short", base64.StdEncoding.EncodeToString(make([]byte, gcmNonceSize+16)), false},
+		{"minimum length", base64.StdEncoding.EncodeToString(make([]byte, gcmNonceSize+17)), true},
+	}
+	for _, tt := range tests {
+		if got := ValidateClientCiphertext(tt.ciphertext); got != tt.want {
+			t.Errorf("%s: ValidateClientCiphertext() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestClientPlaintextSize(t *testing.T) {
+	tests := []struct {
+		name       string
+		ciphertext string
+		want       int
+	}{
+		{"plain text", "hunter2", 0},
+		{"empty", "", 0},
+		{"no plaintext", base64.StdEncoding.EncodeToString(make([]byte, gcmNonceSize+16)), 0},
+		{"one byte", base64.StdEncoding.EncodeToString(make([]byte, gcmNonceSize+17)), 1},
+		{"padded", base64.StdEncoding.EncodeToString(make([]byte, gcmNonceSize+16+100)), 100},
+	}
+	for _, tt := range tests {
+		if got := ClientPlaintextSize(tt.ciphertext); got != tt.want {
+			t.Errorf("%s: ClientPlaintextSize() = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
 func BenchmarkGenerateID(b *testing.B) {
 	for i := 0; i < b.N; i++ {
-		_, _, _, _, _, err := GenerateID()
+		_, err := GenerateID()
 		if err != nil {
 			b.Fatalf("GenerateID() error: %v", err)
 		}
@@ -431,7 +413,8 @@ func BenchmarkGenerateID(b *testing.B) {
 }
 
 func BenchmarkEncrypt(b *testing.B) {
-	_, password, nonce, salt, _, _ := GenerateID()
+	id, _ := GenerateID()
+	password, nonce, salt := id.Password, id.Nonce, id.Salt
 	plaintext := strings.Repeat("x", 1000)
 
 	b.ResetTimer()
@@ -444,7 +427,8 @@ func BenchmarkEncrypt(b *testing.B) {
 }
 
 func BenchmarkDecrypt(b *testing.B) {
-	_, password, nonce, salt, _, _ := GenerateID()
+	id, _ := GenerateID()
+	password, nonce, salt := id.Password, id.Nonce, id.Salt
 	plaintext := strings.Repeat("x", 1000)
 	ciphertext, _ := Encrypt(plaintext, password, nonce, salt)
 
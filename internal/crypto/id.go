@@ -0,0 +1,275 @@
+package crypto
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// Version identifies the layout of an ID and the scheme used to encrypt the
+// secret it refers to. Versioned IDs start with the base62 digit of their
+// version, so the crypto can change while links already handed out keep
+// working until they expire.
+type Version byte
+
+const (
+	// VersionLegacy is the unprefixed 72 character ID issued before IDs were
+	// versioned.
+	VersionLegacy Version = 0
+	// Version1 is VersionLegacy with a version prefix: scrypt key derivation
+	// and AES-256-GCM, using the ASCII bytes of base62 text from the ID as the
+	// nonce and salt.
+	Version1 Version = 1
+	// Version2 uses the same key derivation and cipher as Version1 with a
+	// full-entropy 96 bit nonce and 128 bit salt, encoded as fixed-width
+	// base62.
+	Version2 Version = 2
+
+	// CurrentVersion is the version issued by GenerateID.
+	CurrentVersion = Version2
+)
+
+const (
+	// KeyLength is the length of the database key component in the ID (8 chars).
+	KeyLength = 8
+	// PasswordLength is the length of the password component in the ID (32 chars).
+	PasswordLength = 32
+	// NonceLength is the length of the nonce component in VersionLegacy and
+	// Version1 IDs (16 chars).
+	NonceLength = 16
+	// SaltLength is the length of the salt component in VersionLegacy and
+	// Version1 IDs (16 chars).
+	SaltLength = 16
+	// LegacyIDLength is the length of a VersionLegacy ID (72 chars). No other
+	// version may use this length, as it is how legacy IDs are recognised.
+	LegacyIDLength = KeyLength + PasswordLength + NonceLength + SaltLength
+
+	// NonceSize is the number of random nonce bytes in Version2 IDs.
+	NonceSize = gcmNonceSize
+	// SaltSize is the number of random salt bytes in Version2 IDs.
+	SaltSize = 16
+	// EncodedNonceLength is the length of the base62 encoded nonce in Version2
+	// IDs (17 chars).
+	EncodedNonceLength = 17
+	// EncodedSaltLength is the length of the base62 encoded salt in Version2
+	// IDs (22 chars).
+	EncodedSaltLength = 22
+
+	// FullIDLength is the length of an ID issued by GenerateID (80 chars).
+	FullIDLength = 1 + KeyLength + PasswordLength + EncodedNonceLength + EncodedSaltLength
+)
+
+var (
+	// ErrInvalidIDLength is returned when the ID length does not match its version.
+	ErrInvalidIDLength = errors.New("invalid ID length")
+	// ErrInvalidIDCharacters is returned when the ID contains non-base62 characters.
+	ErrInvalidIDCharacters = errors.New("invalid ID: contains non-base62 characters")
+	// ErrUnsupportedIDVersion is returned when the ID prefix names an unknown version.
+	ErrUnsupportedIDVersion = errors.New("invalid ID: unsupported version")
+	// ErrInvalidIDEncoding is returned when an encoded ID component is out of range.
+	ErrInvalidIDEncoding = errors.New("invalid ID: malformed component")
+)
+
+// ID is a parsed secret ID. Key locates the secret in the store and the
+// remaining components decrypt it; the server never stores them. Nonce and
+// Salt hold the bytes passed to the cipher and key derivation: the base62 text
+// itself for VersionLegacy and Version1 IDs, of which only the first
+// NonceSize nonce bytes are used, and the decoded random bytes for Version2.
+type ID struct {
+	Version  Version
+	Key      string
+	Password string
+	Nonce    string
+	Salt     string
+}
+
+// GenerateID generates a new random ID of the CurrentVersion containing all
+// encryption parameters.
+//
+// The ID format is: [1-char Version] + [8-char Key] + [32-char Password] +
+// [17-char Nonce] + [22-char Salt]
+//
+//   - version: The base62 digit of the ID version
+//   - key: Used as database lookup key (not secret)
+//   - password: Used with scrypt to derive the AES encryption key (secret)
+//   - nonce: 96 random bits for AES-GCM (ensures non-deterministic encryption)
+//   - salt: 128 random bits for scrypt key derivation
+func GenerateID() (ID, error) {
+	key, err := generateRandomBase62(KeyLength)
+	if err != nil {
+		return ID{}, fmt.Errorf("failed to generate key: %w", err)
+	}
+
+	password, err := generateRandomBase62(PasswordLength)
+	if err != nil {
+		return ID{}, fmt.Errorf("failed to generate password: %w", err)
+	}
+
+	nonce := make([]byte, NonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return ID{}, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	salt := make([]byte, SaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return ID{}, fmt.Errorf("failed to generate salt: %w", err)
+	}
+
+	return ID{Version: CurrentVersion, Key: key, Password: password, Nonce: string(nonce), Salt: string(salt)}, nil
+}
+
+// ParseID parses an ID of any supported version. IDs of LegacyIDLength are
+// parsed as VersionLegacy; any other ID is parsed according to the version
+// named by its first character.
+func ParseID(fullID string) (ID, error) {
+	if len(fullID) == LegacyIDLength {
+		if !isBase62(fullID) {
+			return ID{}, ErrInvalidIDCharacters
+		}
+		return parseComponents(VersionLegacy, fullID), nil
+	}
+
+	if len(fullID) == 0 {
+		return ID{}, ErrInvalidIDLength
+	}
+	if !isBase62(fullID) {
+		return ID{}, ErrInvalidIDCharacters
+	}
+
+	switch v := Version(strings.IndexByte(base62Alphabet, fullID[0])); v {
+	case Version1:
+		if len(fullID) != 1+LegacyIDLength {
+			return ID{}, ErrInvalidIDLength
+		}
+		return parseComponents(v, fullID[1:]), nil
+	case Version2:
+		if len(fullID) != FullIDLength {
+			return ID{}, ErrInvalidIDLength
+		}
+		return parseVersion2(fullID[1:])
+	default:
+		return ID{}, ErrUnsupportedIDVersion
+	}
+}
+
+// isBase62 reports whether s consists of base62 characters only.
+func isBase62(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if !isBase62Char(s[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// parseComponents splits the unprefixed body of a VersionLegacy or Version1 ID.
+func parseComponents(v Version, body string) ID {
+	return ID{
+		Version:  v,
+		Key:      body[:KeyLength],
+		Password: body[KeyLength : KeyLength+PasswordLength],
+		Nonce:    body[KeyLength+PasswordLength : KeyLength+PasswordLength+NonceLength],
+		Salt:     body[KeyLength+PasswordLength+NonceLength:],
+	}
+}
+
+// parseVersion2 splits the unprefixed body of a Version2 ID and decodes its
+// nonce and salt.
+func parseVersion2(body string) (ID, error) {
+	encodedNonce := body[KeyLength+PasswordLength : KeyLength+PasswordLength+EncodedNonceLength]
+	nonce, err := decodeFixedBase62(encodedNonce, NonceSize)
+	if err != nil {
+		return ID{}, err
+	}
+	salt, err := decodeFixedBase62(body[KeyLength+PasswordLength+EncodedNonceLength:], SaltSize)
+	if err != nil {
+		return ID{}, err
+	}
+	return ID{
+		Version:  Version2,
+		Key:      body[:KeyLength],
+		Password: body[KeyLength : KeyLength+PasswordLength],
+		Nonce:    string(nonce),
+		Salt:     string(salt),
+	}, nil
+}
+
+// String returns the ID in the form given to users and accepted by ParseID.
+func (id ID) String() string {
+	switch id.Version {
+	case VersionLegacy:
+		return id.Key + id.Password + id.Nonce + id.Salt
+	case Version1:
+		return string(base62Alphabet[id.Version]) + id.Key + id.Password + id.Nonce + id.Salt
+	default:
+		return string(base62Alphabet[id.Version]) + id.Key + id.Password +
+			encodeFixedBase62([]byte(id.Nonce), EncodedNonceLength) +
+			encodeFixedBase62([]byte(id.Salt), EncodedSaltLength)
+	}
+}
+
+// Encrypt encrypts plaintext with the scheme of the ID's version, deriving the
+// key with kdf. A non-empty passphrase is mixed into the key derivation as in
+// EncryptBytes.
+func (id ID) Encrypt(plaintext []byte, passphrase string, kdf KDFParams) ([]byte, error) {
+	switch id.Version {
+	case VersionLegacy, Version1, Version2:
+		return encryptBytes(plaintext, id.Password, passphrase, id.Nonce, id.Salt, kdf)
+	default:
+		return nil, ErrUnsupportedIDVersion
+	}
+}
+
+// Decrypt decrypts ciphertext produced by Encrypt with an ID of the same
+// version and the same kdf.
+func (id ID) Decrypt(ciphertext []byte, passphrase string, kdf KDFParams) ([]byte, error) {
+	switch id.Version {
+	case VersionLegacy, Version1, Version2:
+		return decryptBytes(ciphertext, id.Password, passphrase, id.Nonce, id.Salt, kdf)
+	default:
+		return nil, ErrUnsupportedIDVersion
+	}
+}
+
+// ValidateID validates that an ID is well-formed without decrypting anything.
+func ValidateID(fullID string) bool {
+	_, err := ParseID(fullID)
+	return err == nil
+}
+
+// encodeFixedBase62 encodes data as base62, left padded with zero digits to
+// length characters. length must be enough to hold any value of len(data)
+// bytes.
+func encodeFixedBase62(data []byte, length int) string {
+	num := new(big.Int).SetBytes(data)
+	base := big.NewInt(62)
+	mod := new(big.Int)
+
+	result := []byte(strings.Repeat(base62Alphabet[:1], length))
+	for i := length - 1; i >= 0 && num.Sign() > 0; i-- {
+		num.DivMod(num, base, mod)
+		result[i] = base62Alphabet[mod.Int64()]
+	}
+	return string(result)
+}
+
+// decodeFixedBase62 decodes base62 text produced by encodeFixedBase62 into
+// size bytes. It returns ErrInvalidIDEncoding if the value does not fit.
+func decodeFixedBase62(s string, size int) ([]byte, error) {
+	num := new(big.Int)
+	base := big.NewInt(62)
+	for i := 0; i < len(s); i++ {
+		digit := strings.IndexByte(base62Alphabet, s[i])
+		if digit < 0 {
+			return nil, ErrInvalidIDCharacters
+		}
+		num.Mul(num, base)
+		num.Add(num, big.NewInt(int64(digit)))
+	}
+	if num.BitLen() > size*8 {
+		return nil, ErrInvalidIDEncoding
+	}
+	return num.FillBytes(make([]byte, size)), nil
+}
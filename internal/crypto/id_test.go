@@ -0,0 +1,376 @@
+package crypto
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestGenerateID(t *testing.T) {
+	id, err := GenerateID()
+
+	if err != nil {
+		t.Fatalf("GenerateID() returned error: %v", err)
+	}
+
+	if id.Version != CurrentVersion {
+		t.Errorf("version = %d, want %d", id.Version, CurrentVersion)
+	}
+
+	if len(id.Key) != KeyLength {
+		t.Errorf("key length = %d, want %d", len(id.Key), KeyLength)
+	}
+
+	if len(id.Password) != PasswordLength {
+		t.Errorf("password length = %d, want %d", len(id.Password), PasswordLength)
+	}
+
+	if len(id.Nonce) != NonceSize {
+		t.Errorf("nonce size = %d, want %d", len(id.Nonce), NonceSize)
+	}
+
+	if len(id.Salt) != SaltSize {
+		t.Errorf("salt size = %d, want %d", len(id.Salt), SaltSize)
+	}
+
+	fullID := id.String()
+	if len(fullID) != FullIDLength {
+		t.Errorf("fullID length = %d, want %d", len(fullID), FullIDLength)
+	}
+
+	if !strings.HasPrefix(fullID, "2"+id.Key+id.Password) {
+		t.Errorf("fullID = %s, want prefix %s", fullID, "2"+id.Key+id.Password)
+	}
+
+	for i, c := range fullID {
+		if !isBase62Char(byte(c)) {
+			t.Errorf("fullID contains invalid character at position %d: %c", i, c)
+		}
+	}
+}
+
+func TestGenerateID_Uniqueness(t *testing.T) {
+	ids := make(map[string]bool)
+	iterations := 100
+
+	for i := 0; i < iterations; i++ {
+		id, err := GenerateID()
+		if err != nil {
+			t.Fatalf("GenerateID() returned error: %v", err)
+		}
+
+		fullID := id.String()
+		if ids[fullID] {
+			t.Errorf("duplicate ID generated: %s", fullID)
+		}
+		ids[fullID] = true
+	}
+}
+
+func TestGenerateID_NonceUniqueness(t *testing.T) {
+	nonces := make(map[string]bool)
+	salts := make(map[string]bool)
+
+	for i := 0; i < 10000; i++ {
+		id, err := GenerateID()
+		if err != nil {
+			t.Fatalf("GenerateID() returned error: %v", err)
+		}
+
+		if nonces[id.Nonce] {
+			t.Fatalf("duplicate nonce generated: %x", id.Nonce)
+		}
+		nonces[id.Nonce] = true
+		if salts[id.Salt] {
+			t.Fatalf("duplicate salt generated: %x", id.Salt)
+		}
+		salts[id.Salt] = true
+	}
+}
+
+func TestFixedBase62(t *testing.T) {
+	tests := []struct {
+		name   string
+		data   []byte
+		length int
+	}{
+		{"zero nonce", make([]byte, NonceSize), EncodedNonceLength},
+		{"max nonce", bytes.Repeat([]byte{0xff}, NonceSize), EncodedNonceLength},
+		{"zero salt", make([]byte, SaltSize), EncodedSaltLength},
+		{"max salt", bytes.Repeat([]byte{0xff}, SaltSize), EncodedSaltLength},
+		{"leading zero", []byte{0, 0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10}, EncodedNonceLength},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encoded := encodeFixedBase62(tt.data, tt.length)
+			if len(encoded) != tt.length {
+				t.Errorf("encoded length = %d, want %d", len(encoded), tt.length)
+			}
+
+			decoded, err := decodeFixedBase62(encoded, len(tt.data))
+			if err != nil {
+				t.Fatalf("decodeFixedBase62() error: %v", err)
+			}
+			if !bytes.Equal(decoded, tt.data) {
+				t.Errorf("decoded = %x, want %x", decoded, tt.data)
+			}
+		})
+	}
+
+	if _, err := decodeFixedBase62(strings.Repeat("Z", EncodedNonceLength), NonceSize); err != ErrInvalidIDEncoding {
+		t.Errorf("decodeFixedBase62() of an out of range value error = %v, want %v", err, ErrInvalidIDEncoding)
+	}
+}
+
+func TestParseID(t *testing.T) {
+	body := "12345678" + strings.Repeat("a", 32) + strings.Repeat("b", 16) + strings.Repeat("c", 16)
+	v2Nonce := []byte("nonce-bytes!")
+	v2Salt := []byte("sixteen salt b!!")
+	v2Body := "12345678" + strings.Repeat("a", 32) +
+		encodeFixedBase62(v2Nonce, EncodedNonceLength) + encodeFixedBase62(v2Salt, EncodedSaltLength)
+	tests := []struct {
+		name    string
+		fullID  string
+		want    ID
+		wantErr error
+	}{
+		{
+			name:   "legacy ID",
+			fullID: body,
+			want: ID{
+				Version:  VersionLegacy,
+				Key:      "12345678",
+				Password: strings.Repeat("a", 32),
+				Nonce:    strings.Repeat("b", 16),
+				Salt:     strings.Repeat("c", 16),
+			},
+		},
+		{
+			name:   "version 1 ID",
+			fullID: "1" + body,
+			want: ID{
+				Version:  Version1,
+				Key:      "12345678",
+				Password: strings.Repeat("a", 32),
+				Nonce:    strings.Repeat("b", 16),
+				Salt:     strings.Repeat("c", 16),
+			},
+		},
+		{
+			name:   "version 2 ID",
+			fullID: "2" + v2Body,
+			want: ID{
+				Version:  Version2,
+				Key:      "12345678",
+				Password: strings.Repeat("a", 32),
+				Nonce:    string(v2Nonce),
+				Salt:     string(v2Salt),
+			},
+		},
+		{
+			name:    "version 2 ID too short",
+			fullID:  "2" + body,
+			wantErr: ErrInvalidIDLength,
+		},
+		{
+			name:    "version 2 nonce out of range",
+			fullID:  "2" + "12345678" + strings.Repeat("a", 32) + strings.Repeat("Z", EncodedNonceLength+EncodedSaltLength),
+			wantErr: ErrInvalidIDEncoding,
+		},
+		{
+			name:    "empty",
+			fullID:  "",
+			wantErr: ErrInvalidIDLength,
+		},
+		{
+			name:    "too short",
+			fullID:  "1short",
+			wantErr: ErrInvalidIDLength,
+		},
+		{
+			name:    "too long",
+			fullID:  "1" + body + "d",
+			wantErr: ErrInvalidIDLength,
+		},
+		{
+			name:    "unsupported version",
+			fullID:  "z" + body,
+			wantErr: ErrUnsupportedIDVersion,
+		},
+		{
+			name:    "version 0 prefix",
+			fullID:  "0" + body,
+			wantErr: ErrUnsupportedIDVersion,
+		},
+		{
+			name:    "invalid characters",
+			fullID:  strings.Repeat("!", 72),
+			wantErr: ErrInvalidIDCharacters,
+		},
+		{
+			name:    "contains space",
+			fullID:  strings.Repeat("a", 35) + " " + strings.Repeat("b", 36),
+			wantErr: ErrInvalidIDCharacters,
+		},
+		{
+			name:    "versioned ID contains space",
+			fullID:  "1" + strings.Repeat("a", 35) + " " + strings.Repeat("b", 36),
+			wantErr: ErrInvalidIDCharacters,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseID(tt.fullID)
+
+			if tt.wantErr != nil {
+				if err != tt.wantErr {
+					t.Errorf("ParseID() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("ParseID() unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("ParseID() = %+v, want %+v", got, tt.want)
+			}
+			if s := got.String(); s != tt.fullID {
+				t.Errorf("String() = %s, want %s", s, tt.fullID)
+			}
+		})
+	}
+}
+
+func TestParseID_RoundTrip(t *testing.T) {
+	id, err := GenerateID()
+	if err != nil {
+		t.Fatalf("GenerateID() error: %v", err)
+	}
+
+	parsed, err := ParseID(id.String())
+	if err != nil {
+		t.Fatalf("ParseID() error: %v", err)
+	}
+
+	if parsed != id {
+		t.Errorf("ParseID() = %+v, want %+v", parsed, id)
+	}
+}
+
+func TestID_EncryptDecrypt(t *testing.T) {
+	id, err := GenerateID()
+	if err != nil {
+		t.Fatalf("GenerateID() error: %v", err)
+	}
+
+	ciphertext, err := id.Encrypt([]byte("versioned secret"), "pass", DefaultKDF)
+	if err != nil {
+		t.Fatalf("Encrypt() error: %v", err)
+	}
+
+	decrypted, err := id.Decrypt(ciphertext, "pass", DefaultKDF)
+	if err != nil {
+		t.Fatalf("Decrypt() error: %v", err)
+	}
+	if string(decrypted) != "versioned secret" {
+		t.Errorf("Decrypt() = %q, want %q", decrypted, "versioned secret")
+	}
+
+	if _, err := id.Decrypt(ciphertext, "wrong", DefaultKDF); err != ErrDecryptionFailed {
+		t.Errorf("Decrypt() with wrong passphrase error = %v, want %v", err, ErrDecryptionFailed)
+	}
+}
+
+func TestID_DecryptOldVersions(t *testing.T) {
+	key, _ := generateRandomBase62(KeyLength)
+	password, _ := generateRandomBase62(PasswordLength)
+	nonce, _ := generateRandomBase62(NonceLength)
+	salt, _ := generateRandomBase62(SaltLength)
+
+	// Secrets shared before the current version were encrypted with Encrypt
+	// and the base62 text of the ID.
+	ciphertext, err := Encrypt("old secret", password, nonce, salt)
+	if err != nil {
+		t.Fatalf("Encrypt() error: %v", err)
+	}
+
+	for _, tt := range []struct {
+		fullID  string
+		version Version
+	}{
+		{key + password + nonce + salt, VersionLegacy},
+		{"1" + key + password + nonce + salt, Version1},
+	} {
+		id, err := ParseID(tt.fullID)
+		if err != nil {
+			t.Fatalf("ParseID() error: %v", err)
+		}
+		if id.Version != tt.version {
+			t.Fatalf("version = %d, want %d", id.Version, tt.version)
+		}
+
+		decrypted, err := id.Decrypt(ciphertext, "", DefaultKDF)
+		if err != nil {
+			t.Fatalf("Decrypt() version %d error: %v", tt.version, err)
+		}
+		if !bytes.Equal(decrypted, []byte("old secret")) {
+			t.Errorf("Decrypt() version %d = %q, want %q", tt.version, decrypted, "old secret")
+		}
+	}
+}
+
+func TestID_UnsupportedVersion(t *testing.T) {
+	id := ID{Version: 61}
+
+	if _, err := id.Encrypt([]byte("data"), "", DefaultKDF); err != ErrUnsupportedIDVersion {
+		t.Errorf("Encrypt() error = %v, want %v", err, ErrUnsupportedIDVersion)
+	}
+	if _, err := id.Decrypt([]byte("data"), "", DefaultKDF); err != ErrUnsupportedIDVersion {
+		t.Errorf("Decrypt() error = %v, want %v", err, ErrUnsupportedIDVersion)
+	}
+}
+
+func TestValidateID(t *testing.T) {
+	tests := []struct {
+		name string
+		id   string
+		want bool
+	}{
+		{"valid legacy all lowercase", strings.Repeat("a", 72), true},
+		{"valid legacy all uppercase", strings.Repeat("A", 72), true},
+		{"valid legacy all digits", strings.Repeat("0", 72), true},
+		{"valid legacy mixed", "12345678" + strings.Repeat("aB", 32), true},
+		{"valid version 1", "1" + strings.Repeat("a", 72), true},
+		{"valid version 2", "2" + strings.Repeat("a", 40) + strings.Repeat("0", 39), true},
+		{"too short", strings.Repeat("a", 71), false},
+		{"unsupported version", strings.Repeat("a", 73), false},
+		{"too long", "1" + strings.Repeat("a", 73), false},
+		{"empty", "", false},
+		{"contains space", strings.Repeat("a", 35) + " " + strings.Repeat("a", 36), false},
+		{"contains special char", strings.Repeat("a", 35) + "!" + strings.Repeat("a", 36), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ValidateID(tt.id); got != tt.want {
+				t.Errorf("ValidateID() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateID_GeneratedID(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		id, err := GenerateID()
+		if err != nil {
+			t.Fatalf("GenerateID() error: %v", err)
+		}
+
+		if !ValidateID(id.String()) {
+			t.Errorf("ValidateID() returned false for generated ID: %s", id)
+		}
+	}
+}
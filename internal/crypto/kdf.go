@@ -0,0 +1,138 @@
+package crypto
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/scrypt"
+)
+
+// Key derivation functions supported by KDFParams.
+const (
+	KDFScrypt   = "scrypt"
+	KDFArgon2id = "argon2id"
+)
+
+// ErrInvalidKDFParams is returned for unknown or out of range key derivation
+// parameters.
+var ErrInvalidKDFParams = errors.New("invalid key derivation parameters")
+
+// KDFParams selects the function deriving the AES key from the ID password
+// and passphrase, and its cost. N, R and P are used by KDFScrypt; Time, Memory
+// and Threads by KDFArgon2id.
+//
+// The parameters a secret was encrypted with must be stored alongside its
+// ciphertext, in the form returned by String, so the cost can be changed
+// without breaking existing secrets.
+type KDFParams struct {
+	Algorithm string
+
+	// N is the scrypt CPU/memory cost, a power of two.
+	N int
+	// R is the scrypt block size.
+	R int
+	// P is the scrypt parallelism.
+	P int
+
+	// Time is the number of Argon2id passes over the memory.
+	Time uint32
+	// Memory is the Argon2id memory size in KiB.
+	Memory uint32
+	// Threads is the Argon2id parallelism.
+	Threads uint8
+}
+
+// DefaultKDF is the scrypt configuration used before the key derivation was
+// configurable. It applies to secrets stored without parameters.
+var DefaultKDF = KDFParams{Algorithm: KDFScrypt, N: scryptN, R: scryptR, P: scryptP}
+
+// Validate reports whether the parameters can be used to derive a key.
+func (k KDFParams) Validate() error {
+	switch k.Algorithm {
+	case KDFScrypt:
+		if k.N <= 1 || k.N&(k.N-1) != 0 {
+			return fmt.Errorf("%w: scrypt N must be a power of two greater than 1", ErrInvalidKDFParams)
+		}
+		if k.R < 1 || k.P < 1 || k.R*k.P >= 1<<30 {
+			return fmt.Errorf("%w: scrypt r and p must be positive and r*p below 2^30", ErrInvalidKDFParams)
+		}
+	case KDFArgon2id:
+		if k.Time < 1 || k.Threads < 1 {
+			return fmt.Errorf("%w: argon2id time and threads must be positive", ErrInvalidKDFParams)
+		}
+		if k.Memory < 8*uint32(k.Threads) {
+			return fmt.Errorf("%w: argon2id memory must be at least 8 KiB per thread", ErrInvalidKDFParams)
+		}
+	default:
+		return fmt.Errorf("%w: unknown algorithm %q", ErrInvalidKDFParams, k.Algorithm)
+	}
+	return nil
+}
+
+// String encodes the parameters in the form accepted by ParseKDFParams, for
+// example "scrypt:n=131072,r=8,p=1" or "argon2id:t=3,m=65536,p=4".
+func (k KDFParams) String() string {
+	switch k.Algorithm {
+	case KDFArgon2id:
+		return fmt.Sprintf("%s:t=%d,m=%d,p=%d", k.Algorithm, k.Time, k.Memory, k.Threads)
+	default:
+		return fmt.Sprintf("%s:n=%d,r=%d,p=%d", k.Algorithm, k.N, k.R, k.P)
+	}
+}
+
+// ParseKDFParams decodes parameters encoded by KDFParams.String. An empty
+// string returns DefaultKDF.
+func ParseKDFParams(s string) (KDFParams, error) {
+	if s == "" {
+		return DefaultKDF, nil
+	}
+
+	alg, rest, _ := strings.Cut(s, ":")
+	values := make(map[string]int)
+	for _, field := range strings.Split(rest, ",") {
+		name, value, ok := strings.Cut(field, "=")
+		n, err := strconv.Atoi(value)
+		if !ok || err != nil || n < 0 {
+			return KDFParams{}, fmt.Errorf("%w: malformed field %q", ErrInvalidKDFParams, field)
+		}
+		values[name] = n
+	}
+
+	k := KDFParams{Algorithm: alg}
+	switch alg {
+	case KDFScrypt:
+		k.N, k.R, k.P = values["n"], values["r"], values["p"]
+	case KDFArgon2id:
+		if values["t"] > 1<<32-1 || values["m"] > 1<<32-1 || values["p"] > 1<<8-1 {
+			return KDFParams{}, fmt.Errorf("%w: argon2id parameter out of range", ErrInvalidKDFParams)
+		}
+		k.Time, k.Memory, k.Threads = uint32(values["t"]), uint32(values["m"]), uint8(values["p"])
+	}
+	if err := k.Validate(); err != nil {
+		return KDFParams{}, err
+	}
+	return k, nil
+}
+
+// deriveKey derives the AES key from the ID password and optional passphrase.
+// The passphrase is appended after a NUL separator, which cannot appear in the
+// base62 password, so an empty passphrase derives the same key as before
+// passphrases were supported.
+func (k KDFParams) deriveKey(password, passphrase, salt string) ([]byte, error) {
+	if err := k.Validate(); err != nil {
+		return nil, err
+	}
+
+	secret := []byte(password)
+	if passphrase != "" {
+		secret = append(append(secret, 0), passphrase...)
+	}
+
+	if k.Algorithm == KDFArgon2id {
+		return argon2.IDKey(secret, []byte(salt), k.Time, k.Memory, k.Threads, aesKeySize), nil
+	}
+	return scrypt.Key(secret, []byte(salt), k.N, k.R, k.P, aesKeySize)
+}
@@ -0,0 +1,143 @@
+package crypto
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+)
+
+// testArgon2id is a cheap Argon2id configuration for tests.
+var testArgon2id = KDFParams{Algorithm: KDFArgon2id, Time: 1, Memory: 64, Threads: 1}
+
+// fullCostKDF is DefaultKDF as shipped, which TestMain replaces with a cheap
+// scrypt configuration for the tests deriving keys through Encrypt and
+// Decrypt.
+var fullCostKDF = DefaultKDF
+
+func TestMain(m *testing.M) {
+	DefaultKDF = KDFParams{Algorithm: KDFScrypt, N: 1024, R: 8, P: 1}
+	os.Exit(m.Run())
+}
+
+func TestDefaultKDF_RoundTrip(t *testing.T) {
+	id, err := GenerateID()
+	if err != nil {
+		t.Fatalf("GenerateID() error: %v", err)
+	}
+	ciphertext, err := id.Encrypt([]byte("full cost"), "pass", fullCostKDF)
+	if err != nil {
+		t.Fatalf("Encrypt() error: %v", err)
+	}
+	plaintext, err := id.Decrypt(ciphertext, "pass", fullCostKDF)
+	if err != nil || string(plaintext) != "full cost" {
+		t.Errorf("Decrypt() = %q, %v, want %q", plaintext, err, "full cost")
+	}
+}
+
+func TestParseKDFParams(t *testing.T) {
+	tests := []struct {
+		name    string
+		s       string
+		want    KDFParams
+		wantErr bool
+	}{
+		{name: "empty is default", s: "", want: DefaultKDF},
+		{name: "scrypt", s: "scrypt:n=32768,r=8,p=2", want: KDFParams{Algorithm: KDFScrypt, N: 32768, R: 8, P: 2}},
+		{name: "argon2id", s: "argon2id:t=3,m=65536,p=4", want: KDFParams{Algorithm: KDFArgon2id, Time: 3, Memory: 65536, Threads: 4}},
+		{name: "unknown algorithm", s: "bcrypt:c=10", wantErr: true},
+		{name: "missing parameters", s: "scrypt", wantErr: true},
+		{name: "malformed field", s: "scrypt:n=abc,r=8,p=1", wantErr: true},
+		{name: "negative field", s: "scrypt:n=-2,r=8,p=1", wantErr: true},
+		{name: "scrypt N not a power of two", s: "scrypt:n=100000,r=8,p=1", wantErr: true},
+		{name: "scrypt zero r", s: "scrypt:n=1024,r=0,p=1", wantErr: true},
+		{name: "argon2id zero time", s: "argon2id:t=0,m=65536,p=4", wantErr: true},
+		{name: "argon2id too little memory", s: "argon2id:t=1,m=16,p=4", wantErr: true},
+		{name: "argon2id too many threads", s: "argon2id:t=1,m=65536,p=256", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseKDFParams(tt.s)
+
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidKDFParams) {
+					t.Errorf("ParseKDFParams(%q) error = %v, want %v", tt.s, err, ErrInvalidKDFParams)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("ParseKDFParams(%q) unexpected error: %v", tt.s, err)
+			}
+			if got != tt.want {
+				t.Errorf("ParseKDFParams(%q) = %+v, want %+v", tt.s, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestKDFParams_StringRoundTrip(t *testing.T) {
+	for _, k := range []KDFParams{fullCostKDF, testArgon2id, {Algorithm: KDFScrypt, N: 1024, R: 4, P: 3}} {
+		got, err := ParseKDFParams(k.String())
+		if err != nil {
+			t.Fatalf("ParseKDFParams(%q) error: %v", k, err)
+		}
+		if got != k {
+			t.Errorf("ParseKDFParams(%q) = %+v, want %+v", k, got, k)
+		}
+	}
+}
+
+func TestID_EncryptDecrypt_KDF(t *testing.T) {
+	id, err := GenerateID()
+	if err != nil {
+		t.Fatalf("GenerateID() error: %v", err)
+	}
+	cheapScrypt := KDFParams{Algorithm: KDFScrypt, N: 1024, R: 8, P: 1}
+
+	for _, kdf := range []KDFParams{testArgon2id, cheapScrypt} {
+		ciphertext, err := id.Encrypt([]byte("derived"), "", kdf)
+		if err != nil {
+			t.Fatalf("Encrypt() with %s error: %v", kdf, err)
+		}
+
+		plaintext, err := id.Decrypt(ciphertext, "", kdf)
+		if err != nil {
+			t.Fatalf("Decrypt() with %s error: %v", kdf, err)
+		}
+		if string(plaintext) != "derived" {
+			t.Errorf("Decrypt() with %s = %q, want %q", kdf, plaintext, "derived")
+		}
+	}
+
+	ciphertext, err := id.Encrypt([]byte("derived"), "", testArgon2id)
+	if err != nil {
+		t.Fatalf("Encrypt() error: %v", err)
+	}
+	if _, err := id.Decrypt(ciphertext, "", cheapScrypt); err != ErrDecryptionFailed {
+		t.Errorf("Decrypt() with other KDF error = %v, want %v", err, ErrDecryptionFailed)
+	}
+	if _, err := id.Encrypt([]byte("derived"), "", KDFParams{Algorithm: KDFScrypt}); !errors.Is(err, ErrInvalidKDFParams) {
+		t.Errorf("Encrypt() with invalid KDF error = %v, want %v", err, ErrInvalidKDFParams)
+	}
+}
+
+func BenchmarkDeriveKey(b *testing.B) {
+	id, _ := GenerateID()
+	for _, kdf := range []KDFParams{
+		{Algorithm: KDFScrypt, N: 1 << 15, R: 8, P: 1},
+		{Algorithm: KDFScrypt, N: 1 << 16, R: 8, P: 1},
+		fullCostKDF,
+		{Algorithm: KDFArgon2id, Time: 2, Memory: 19 * 1024, Threads: 1},
+		{Algorithm: KDFArgon2id, Time: 3, Memory: 64 * 1024, Threads: 4},
+	} {
+		b.Run(fmt.Sprint(kdf), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := kdf.deriveKey(id.Password, "", id.Salt); err != nil {
+					b.Fatalf("deriveKey() error: %v", err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,206 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+// secretsBucket is the bolt bucket holding the records.
+var secretsBucket = []byte("secrets")
+
+// BoltStore is a SecretStore backed by a bolt database file. Records are
+// stored as JSON in a single bucket.
+type BoltStore struct {
+	db *bolt.DB
+}
+
+// OpenBolt opens or creates the bolt database at path, creating its directory
+// if needed.
+func OpenBolt(path string) (*BoltStore, error) {
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return nil, fmt.Errorf("failed to create database directory: %w", err)
+	}
+	db, err := bolt.Open(path, 0644, nil)
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(secretsBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create bucket: %w", err)
+	}
+	return &BoltStore{db: db}, nil
+}
+
+// decodeRecord decodes a stored record.
+func decodeRecord(data []byte) (Record, error) {
+	var rec Record
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return Record{}, fmt.Errorf("invalid record: %w", err)
+	}
+	return rec, nil
+}
+
+// Put implements SecretStore.
+func (s *BoltStore) Put(_ context.Context, key string, rec Record) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(secretsBucket)
+		if b.Get([]byte(key)) != nil {
+			return ErrKeyExists
+		}
+		return b.Put([]byte(key), data)
+	})
+}
+
+// Get implements SecretStore.
+func (s *BoltStore) Get(_ context.Context, key string) (Record, error) {
+	var rec Record
+	err := s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(secretsBucket).Get([]byte(key))
+		if data == nil {
+			return ErrNotFound
+		}
+		var err error
+		if rec, err = decodeRecord(data); err != nil {
+			return err
+		}
+		if rec.Expired(time.Now()) {
+			return ErrNotFound
+		}
+		return nil
+	})
+	return rec, err
+}
+
+// TakeOnce implements SecretStore. The record is read in a read-only
+// transaction, and the result of fn is stored in a write transaction only if
+// the stored value is still the one passed to fn, so fn never holds bolt's
+// single writer lock.
+func (s *BoltStore) TakeOnce(_ context.Context, key string, fn TakeFunc) error {
+	for {
+		data, err := s.value(key)
+		if err != nil {
+			return err
+		}
+
+		rec, err := decodeRecord(data)
+		if err != nil {
+			return err
+		}
+		var updated *Record
+		expired := rec.Expired(time.Now())
+		if !expired {
+			if updated, err = fn(rec); err != nil {
+				return err
+			}
+		}
+
+		var changed bool
+		err = s.db.Update(func(tx *bolt.Tx) error {
+			b := tx.Bucket(secretsBucket)
+			if !bytes.Equal(b.Get([]byte(key)), data) {
+				changed = true
+				return nil
+			}
+			if updated == nil {
+				return b.Delete([]byte(key))
+			}
+			data, err := json.Marshal(updated)
+			if err != nil {
+				return err
+			}
+			return b.Put([]byte(key), data)
+		})
+		switch {
+		case err != nil:
+			return err
+		case changed:
+			continue
+		case expired:
+			return ErrNotFound
+		}
+		return nil
+	}
+}
+
+// value returns a copy of the value stored under key, or ErrNotFound.
+func (s *BoltStore) value(key string) ([]byte, error) {
+	var data []byte
+	err := s.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(secretsBucket).Get([]byte(key))
+		if v == nil {
+			return ErrNotFound
+		}
+		data = append([]byte(nil), v...)
+		return nil
+	})
+	return data, err
+}
+
+// Delete implements SecretStore.
+func (s *BoltStore) Delete(_ context.Context, key string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(secretsBucket).Delete([]byte(key))
+	})
+}
+
+// Expire implements SecretStore.
+func (s *BoltStore) Expire(_ context.Context, now time.Time) (int, error) {
+	var removed int
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(secretsBucket)
+
+		var expired [][]byte
+		err := b.ForEach(func(k, v []byte) error {
+			rec, err := decodeRecord(v)
+			if err != nil {
+				return err
+			}
+			if rec.Expired(now) {
+				expired = append(expired, append([]byte(nil), k...))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, k := range expired {
+			if err := b.Delete(k); err != nil {
+				return err
+			}
+		}
+		removed = len(expired)
+		return nil
+	})
+	return removed, err
+}
+
+// Stats implements SecretStore.
+func (s *BoltStore) Stats(_ context.Context) (Stats, error) {
+	var stats Stats
+	err := s.db.View(func(tx *bolt.Tx) error {
+		stats.Secrets = tx.Bucket(secretsBucket).Stats().KeyN
+		return nil
+	})
+	return stats, err
+}
+
+// Close implements SecretStore.
+func (s *BoltStore) Close() error {
+	return s.db.Close()
+}
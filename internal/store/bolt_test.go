@@ -0,0 +1,58 @@
+package store
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+func TestBoltStore(t *testing.T) {
+	testSecretStore(t, func(t *testing.T) SecretStore {
+		s, err := OpenBolt(filepath.Join(t.TempDir(), "secrets.db"))
+		if err != nil {
+			t.Fatalf("OpenBolt() error: %v", err)
+		}
+		return s
+	})
+}
+
+func TestOpenBolt_CreatesDirectory(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "nested", "db")
+	s, err := Open(Config{Backend: BackendBolt, BoltPath: filepath.Join(dir, "secrets.db")})
+	if err != nil {
+		t.Fatalf("Open(bolt) error: %v", err)
+	}
+	defer s.Close()
+
+	if _, err := os.Stat(dir); err != nil {
+		t.Errorf("database directory was not created: %v", err)
+	}
+}
+
+func TestBoltStore_InvalidRecord(t *testing.T) {
+	s, err := OpenBolt(filepath.Join(t.TempDir(), "secrets.db"))
+	if err != nil {
+		t.Fatalf("OpenBolt() error: %v", err)
+	}
+	defer s.Close()
+
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(secretsBucket).Put([]byte("corrupt1"), []byte("not a record"))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.Get(t.Context(), "corrupt1"); err == nil {
+		t.Error("Get() of an invalid record succeeded")
+	}
+	if err := s.TakeOnce(t.Context(), "corrupt1", func(Record) (*Record, error) { return nil, nil }); err == nil {
+		t.Error("TakeOnce() of an invalid record succeeded")
+	}
+	if _, err := s.Expire(t.Context(), time.Now()); err == nil {
+		t.Error("Expire() over an invalid record succeeded")
+	}
+}
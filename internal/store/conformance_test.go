@@ -0,0 +1,381 @@
+package store
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testSecretStore runs the conformance suite every SecretStore implementation
+// must pass. newStore returns an empty store, which is closed by the suite.
+func testSecretStore(t *testing.T, newStore func(t *testing.T) SecretStore) {
+	open := func(t *testing.T) SecretStore {
+		t.Helper()
+		s := newStore(t)
+		t.Cleanup(func() { s.Close() })
+		return s
+	}
+	current := func(ct string) Record {
+		return Record{Ciphertext: []byte(ct), ExpiresAt: time.Now().Add(time.Hour).UTC(), RemainingViews: 1}
+	}
+	expired := func(ct string) Record {
+		return Record{Ciphertext: []byte(ct), ExpiresAt: time.Now().Add(-time.Minute).UTC()}
+	}
+
+	t.Run("PutGet", func(t *testing.T) {
+		s := open(t)
+		want := Record{
+			Ciphertext:      []byte{0x00, 0x01, 0xfe, 0xff},
+			ExpiresAt:       time.Now().Add(time.Hour).UTC().Truncate(time.Millisecond),
+			ClientEncrypted: true,
+			Passphrase:      true,
+			FailedAttempts:  2,
+			RemainingViews:  5,
+			File:            true,
+			KDF:             "scrypt:n=1024,r=8,p=1",
+		}
+		if err := s.Put(t.Context(), "key00001", want); err != nil {
+			t.Fatalf("Put() error: %v", err)
+		}
+		got, err := s.Get(t.Context(), "key00001")
+		if err != nil {
+			t.Fatalf("Get() error: %v", err)
+		}
+		if !bytes.Equal(got.Ciphertext, want.Ciphertext) || !got.ExpiresAt.Equal(want.ExpiresAt) {
+			t.Errorf("Get() = %+v, want %+v", got, want)
+		}
+		got.Ciphertext, want.Ciphertext = nil, nil
+		got.ExpiresAt, want.ExpiresAt = time.Time{}, time.Time{}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("Get() metadata = %+v, want %+v", got, want)
+		}
+	})
+
+	t.Run("PutExistingKey", func(t *testing.T) {
+		s := open(t)
+		if err := s.Put(t.Context(), "key00001", current("first")); err != nil {
+			t.Fatalf("Put() error: %v", err)
+		}
+		if err := s.Put(t.Context(), "key00001", current("second")); !errors.Is(err, ErrKeyExists) {
+			t.Errorf("Put() existing key error = %v, want %v", err, ErrKeyExists)
+		}
+		if got, err := s.Get(t.Context(), "key00001"); err != nil || string(got.Ciphertext) != "first" {
+			t.Errorf("Get() = %q, %v, want the first record", got.Ciphertext, err)
+		}
+	})
+
+	t.Run("GetMissingOrExpired", func(t *testing.T) {
+		s := open(t)
+		if err := s.Put(t.Context(), "expired1", expired("old")); err != nil {
+			t.Fatalf("Put() error: %v", err)
+		}
+		for _, key := range []string{"missing1", "expired1"} {
+			if _, err := s.Get(t.Context(), key); !errors.Is(err, ErrNotFound) {
+				t.Errorf("Get(%q) error = %v, want %v", key, err, ErrNotFound)
+			}
+		}
+	})
+
+	t.Run("TakeOnceDeletes", func(t *testing.T) {
+		s := open(t)
+		if err := s.Put(t.Context(), "key00001", current("burn me")); err != nil {
+			t.Fatalf("Put() error: %v", err)
+		}
+		var got Record
+		err := s.TakeOnce(t.Context(), "key00001", func(rec Record) (*Record, error) {
+			got = rec
+			return nil, nil
+		})
+		if err != nil {
+			t.Fatalf("TakeOnce() error: %v", err)
+		}
+		if string(got.Ciphertext) != "burn me" {
+			t.Errorf("TakeOnce() passed %q, want %q", got.Ciphertext, "burn me")
+		}
+		if _, err := s.Get(t.Context(), "key00001"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Get() after TakeOnce error = %v, want %v", err, ErrNotFound)
+		}
+		err = s.TakeOnce(t.Context(), "key00001", func(Record) (*Record, error) {
+			t.Error("TakeOnce() called fn for a deleted record")
+			return nil, nil
+		})
+		if !errors.Is(err, ErrNotFound) {
+			t.Errorf("second TakeOnce() error = %v, want %v", err, ErrNotFound)
+		}
+	})
+
+	t.Run("TakeOnceReplaces", func(t *testing.T) {
+		s := open(t)
+		rec := current("keep me")
+		rec.RemainingViews = 2
+		if err := s.Put(t.Context(), "key00001", rec); err != nil {
+			t.Fatalf("Put() error: %v", err)
+		}
+		err := s.TakeOnce(t.Context(), "key00001", func(rec Record) (*Record, error) {
+			rec.RemainingViews--
+			return &rec, nil
+		})
+		if err != nil {
+			t.Fatalf("TakeOnce() error: %v", err)
+		}
+		got, err := s.Get(t.Context(), "key00001")
+		if err != nil || got.RemainingViews != 1 || string(got.Ciphertext) != "keep me" {
+			t.Errorf("Get() after TakeOnce = %+v, %v, want the updated record", got, err)
+		}
+	})
+
+	t.Run("TakeOnceErrorKeepsRecord", func(t *testing.T) {
+		s := open(t)
+		if err := s.Put(t.Context(), "key00001", current("still here")); err != nil {
+			t.Fatalf("Put() error: %v", err)
+		}
+		errFn := errors.New("fn failed")
+		err := s.TakeOnce(t.Context(), "key00001", func(rec Record) (*Record, error) {
+			return nil, errFn
+		})
+		if !errors.Is(err, errFn) {
+			t.Errorf("TakeOnce() error = %v, want %v", err, errFn)
+		}
+		if _, err := s.Get(t.Context(), "key00001"); err != nil {
+			t.Errorf("Get() after failed TakeOnce error: %v", err)
+		}
+	})
+
+	t.Run("TakeOnceExpired", func(t *testing.T) {
+		s := open(t)
+		if err := s.Put(t.Context(), "expired1", expired("too late")); err != nil {
+			t.Fatalf("Put() error: %v", err)
+		}
+		err := s.TakeOnce(t.Context(), "expired1", func(Record) (*Record, error) {
+			t.Error("TakeOnce() called fn for an expired record")
+			return nil, nil
+		})
+		if !errors.Is(err, ErrNotFound) {
+			t.Errorf("TakeOnce() error = %v, want %v", err, ErrNotFound)
+		}
+		if stats, err := s.Stats(t.Context()); err != nil || stats.Secrets != 0 {
+			t.Errorf("Stats() = %+v, %v, want the expired record deleted", stats, err)
+		}
+	})
+
+	t.Run("TakeOnceConcurrent", func(t *testing.T) {
+		s := open(t)
+		rec := current("three times")
+		rec.RemainingViews = 3
+		if err := s.Put(t.Context(), "key00001", rec); err != nil {
+			t.Fatalf("Put() error: %v", err)
+		}
+
+		// fn may run more than once, but only as many calls as the record
+		// has views may succeed.
+		const takers = 10
+		var (
+			wg    sync.WaitGroup
+			mu    sync.Mutex
+			taken int
+		)
+		for i := 0; i < takers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				err := s.TakeOnce(t.Context(), "key00001", func(rec Record) (*Record, error) {
+					if rec.RemainingViews <= 1 {
+						return nil, nil
+					}
+					rec.RemainingViews--
+					return &rec, nil
+				})
+				if err == nil {
+					mu.Lock()
+					taken++
+					mu.Unlock()
+				} else if !errors.Is(err, ErrNotFound) {
+					t.Errorf("TakeOnce() unexpected error: %v", err)
+				}
+			}()
+		}
+		wg.Wait()
+
+		if taken != 3 {
+			t.Errorf("record was taken %d times, want exactly 3", taken)
+		}
+	})
+
+	t.Run("TakeOnceRecordChanged", func(t *testing.T) {
+		s := open(t)
+		rec := current("viewed twice")
+		rec.RemainingViews = 3
+		if err := s.Put(t.Context(), "key00001", rec); err != nil {
+			t.Fatalf("Put() error: %v", err)
+		}
+
+		decrement := func(rec Record) (*Record, error) {
+			rec.RemainingViews--
+			return &rec, nil
+		}
+		var calls int
+		err := s.TakeOnce(t.Context(), "key00001", func(rec Record) (*Record, error) {
+			calls++
+			if calls == 1 {
+				// Another viewer takes the record while this fn runs.
+				if err := s.TakeOnce(t.Context(), "key00001", decrement); err != nil {
+					t.Fatalf("concurrent TakeOnce() error: %v", err)
+				}
+			}
+			return decrement(rec)
+		})
+		if err != nil {
+			t.Fatalf("TakeOnce() error: %v", err)
+		}
+		if calls != 2 {
+			t.Errorf("fn called %d times, want 2", calls)
+		}
+		got, err := s.Get(t.Context(), "key00001")
+		if err != nil || got.RemainingViews != 1 {
+			t.Errorf("Get() after TakeOnce = %+v, %v, want 1 remaining view", got, err)
+		}
+	})
+
+	t.Run("TakeOnceDoesNotBlock", func(t *testing.T) {
+		s := open(t)
+		if err := s.Put(t.Context(), "key00001", current("slow")); err != nil {
+			t.Fatalf("Put() error: %v", err)
+		}
+
+		started, release := make(chan struct{}), make(chan struct{})
+		taken := make(chan error, 1)
+		go func() {
+			taken <- s.TakeOnce(t.Context(), "key00001", func(Record) (*Record, error) {
+				close(started)
+				<-release
+				return nil, nil
+			})
+		}()
+		<-started
+
+		// A slow fn, such as a key derivation, must not stop other secrets
+		// being created, read or swept.
+		done := make(chan error, 1)
+		go func() {
+			if err := s.Put(t.Context(), "key00002", current("other")); err != nil {
+				done <- err
+				return
+			}
+			if _, err := s.Get(t.Context(), "key00002"); err != nil {
+				done <- err
+				return
+			}
+			_, err := s.Expire(t.Context(), time.Now())
+			done <- err
+		}()
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Errorf("store call while TakeOnce ran error: %v", err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Error("store calls blocked while TakeOnce ran fn")
+		}
+
+		close(release)
+		if err := <-taken; err != nil {
+			t.Errorf("TakeOnce() error: %v", err)
+		}
+		if _, err := s.Get(t.Context(), "key00001"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Get() after TakeOnce error = %v, want %v", err, ErrNotFound)
+		}
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		s := open(t)
+		if err := s.Put(t.Context(), "key00001", current("delete me")); err != nil {
+			t.Fatalf("Put() error: %v", err)
+		}
+		if err := s.Delete(t.Context(), "key00001"); err != nil {
+			t.Fatalf("Delete() error: %v", err)
+		}
+		if _, err := s.Get(t.Context(), "key00001"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Get() after Delete error = %v, want %v", err, ErrNotFound)
+		}
+		if err := s.Delete(t.Context(), "missing1"); err != nil {
+			t.Errorf("Delete() of a missing key error: %v", err)
+		}
+	})
+
+	t.Run("ExpireAndStats", func(t *testing.T) {
+		s := open(t)
+		now := time.Now()
+		records := map[string]time.Time{
+			"expired1": now.Add(-time.Hour),
+			"expired2": now.Add(-time.Second),
+			"current1": now.Add(time.Hour),
+		}
+		for key, exp := range records {
+			if err := s.Put(t.Context(), key, Record{Ciphertext: []byte("ct"), ExpiresAt: exp.UTC()}); err != nil {
+				t.Fatalf("Put() error: %v", err)
+			}
+		}
+		before, err := s.Stats(t.Context())
+		if err != nil {
+			t.Fatalf("Stats() error: %v", err)
+		}
+
+		// Backends with native expiry may have removed the expired records
+		// already, but either way only the current record must remain.
+		n, err := s.Expire(t.Context(), now)
+		if err != nil {
+			t.Fatalf("Expire() error: %v", err)
+		}
+		if before.Secrets-n != 1 {
+			t.Errorf("Expire() removed %d of %d records, want all but 1", n, before.Secrets)
+		}
+		if _, err := s.Get(t.Context(), "current1"); err != nil {
+			t.Errorf("Get() of unexpired record error: %v", err)
+		}
+		if stats, err := s.Stats(t.Context()); err != nil || stats.Secrets != 1 {
+			t.Errorf("Stats() after Expire = %+v, %v, want 1 secret", stats, err)
+		}
+	})
+}
+
+func TestMemoryStore(t *testing.T) {
+	testSecretStore(t, func(t *testing.T) SecretStore {
+		return NewMemory()
+	})
+}
+
+func TestMemoryStore_DoesNotAlias(t *testing.T) {
+	s := NewMemory()
+	rec := Record{Ciphertext: []byte("original"), ExpiresAt: time.Now().Add(time.Hour)}
+	if err := s.Put(t.Context(), "key00001", rec); err != nil {
+		t.Fatalf("Put() error: %v", err)
+	}
+	rec.Ciphertext[0] = 'X'
+
+	got, err := s.Get(t.Context(), "key00001")
+	if err != nil {
+		t.Fatalf("Get() error: %v", err)
+	}
+	got.Ciphertext[1] = 'X'
+	if got, _ := s.Get(t.Context(), "key00001"); string(got.Ciphertext) != "original" {
+		t.Errorf("stored ciphertext was modified to %q", got.Ciphertext)
+	}
+}
+
+func TestOpen(t *testing.T) {
+	s, err := Open(Config{Backend: BackendMemory})
+	if err != nil {
+		t.Fatalf("Open(memory) error: %v", err)
+	}
+	if _, ok := s.(*MemoryStore); !ok {
+		t.Errorf("Open(memory) = %T, want *MemoryStore", s)
+	}
+	s.Close()
+
+	if _, err := Open(Config{Backend: "carrier-pigeon"}); err == nil {
+		t.Error("Open() with an unknown backend succeeded")
+	}
+}
@@ -0,0 +1,133 @@
+package store
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryStore is a SecretStore that keeps records in memory. Secrets do not
+// survive a restart, which suits tests and deployments that prefer losing
+// secrets to persisting them.
+type MemoryStore struct {
+	mu sync.Mutex
+	// records holds each record behind its own pointer, which is replaced on
+	// every update so TakeOnce can tell whether a record changed.
+	records map[string]*Record
+}
+
+// NewMemory returns an empty MemoryStore.
+func NewMemory() *MemoryStore {
+	return &MemoryStore{records: make(map[string]*Record)}
+}
+
+// clone returns a copy of rec that shares no memory with it, so callers cannot
+// modify stored records.
+func clone(rec Record) *Record {
+	rec.Ciphertext = append([]byte(nil), rec.Ciphertext...)
+	return &rec
+}
+
+// Put implements SecretStore.
+func (s *MemoryStore) Put(_ context.Context, key string, rec Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.records[key]; ok {
+		return ErrKeyExists
+	}
+	s.records[key] = clone(rec)
+	return nil
+}
+
+// Get implements SecretStore.
+func (s *MemoryStore) Get(_ context.Context, key string) (Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rec, ok := s.records[key]
+	if !ok || rec.Expired(time.Now()) {
+		return Record{}, ErrNotFound
+	}
+	return *clone(*rec), nil
+}
+
+// TakeOnce implements SecretStore. The store is only locked to read the
+// record and to store the result of fn.
+func (s *MemoryStore) TakeOnce(_ context.Context, key string, fn TakeFunc) error {
+	for {
+		rec, err := s.current(key)
+		if err != nil {
+			return err
+		}
+		updated, err := fn(*clone(*rec))
+		if err != nil {
+			return err
+		}
+
+		s.mu.Lock()
+		if s.records[key] != rec {
+			// The record changed while fn ran.
+			s.mu.Unlock()
+			continue
+		}
+		if updated == nil {
+			delete(s.records, key)
+		} else {
+			s.records[key] = clone(*updated)
+		}
+		s.mu.Unlock()
+		return nil
+	}
+}
+
+// current returns the unexpired record stored under key, deleting it if it
+// has expired.
+func (s *MemoryStore) current(key string) (*Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rec, ok := s.records[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	if rec.Expired(time.Now()) {
+		delete(s.records, key)
+		return nil, ErrNotFound
+	}
+	return rec, nil
+}
+
+// Delete implements SecretStore.
+func (s *MemoryStore) Delete(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.records, key)
+	return nil
+}
+
+// Expire implements SecretStore.
+func (s *MemoryStore) Expire(_ context.Context, now time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var removed int
+	for key, rec := range s.records {
+		if rec.Expired(now) {
+			delete(s.records, key)
+			removed++
+		}
+	}
+	return removed, nil
+}
+
+// Stats implements SecretStore.
+func (s *MemoryStore) Stats(_ context.Context) (Stats, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return Stats{Secrets: len(s.records)}, nil
+}
+
+// Close implements SecretStore. The records are discarded.
+func (s *MemoryStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records = make(map[string]*Record)
+	return nil
+}
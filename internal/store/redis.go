@@ -0,0 +1,213 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// redisWriteTimeout bounds the write storing the result of a TakeOnce, which
+// is made even if the request is cancelled.
+const redisWriteTimeout = 5 * time.Second
+
+// swapScript replaces the value of KEYS[1] with ARGV[2], expiring it after
+// ARGV[3] milliseconds unless that is 0, if it still holds ARGV[1]. An empty
+// ARGV[2] deletes the key. It returns 1 if the key was updated and 0 if it
+// had changed.
+var swapScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) ~= ARGV[1] then
+	return 0
+end
+if ARGV[2] == "" then
+	redis.call("DEL", KEYS[1])
+elseif ARGV[3] == "0" then
+	redis.call("SET", KEYS[1], ARGV[2])
+else
+	redis.call("SET", KEYS[1], ARGV[2], "PX", ARGV[3])
+end
+return 1
+`)
+
+// redisKeyPrefix namespaces the keys written by RedisStore, so the Redis
+// database can be shared with other applications.
+const redisKeyPrefix = "grb:secret:"
+
+// RedisStore is a SecretStore backed by Redis, which lets several go-read-burn
+// instances share their secrets. Records are stored as JSON with a native key
+// TTL, so Redis removes expired secrets itself.
+//
+// TakeOnce reads the record, passes it to fn and stores the result with a Lua
+// script that only replaces or deletes the record if it is unchanged, so the
+// secret stays visible to other requests while fn runs.
+type RedisStore struct {
+	client *redis.Client
+	prefix string
+}
+
+// OpenRedis connects to the Redis server at url, given in the
+// redis://[user:password@]host:port/db form, and checks that it is reachable.
+func OpenRedis(url string) (*RedisStore, error) {
+	opts, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Redis URL: %w", err)
+	}
+	client := redis.NewClient(opts)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("failed to connect to Redis: %w", err)
+	}
+	return NewRedis(client), nil
+}
+
+// NewRedis returns a RedisStore using client. Closing the store closes client.
+func NewRedis(client *redis.Client) *RedisStore {
+	return &RedisStore{client: client, prefix: redisKeyPrefix}
+}
+
+// set stores rec under the Redis key k if it is unused, expiring it at
+// rec.ExpiresAt. It reports whether the record was stored.
+func (s *RedisStore) set(ctx context.Context, k string, rec Record) (bool, error) {
+	var ttl time.Duration
+	if !rec.ExpiresAt.IsZero() {
+		ttl = time.Until(rec.ExpiresAt)
+		if ttl <= 0 {
+			// The record has already expired, which Redis would reject as an
+			// invalid expire time.
+			return true, nil
+		}
+	}
+
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return false, err
+	}
+	return s.client.SetNX(ctx, k, data, ttl).Result()
+}
+
+// Put implements SecretStore. A record that has already expired is not
+// stored.
+func (s *RedisStore) Put(ctx context.Context, key string, rec Record) error {
+	ok, err := s.set(ctx, s.prefix+key, rec)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrKeyExists
+	}
+	return nil
+}
+
+// Get implements SecretStore.
+func (s *RedisStore) Get(ctx context.Context, key string) (Record, error) {
+	data, err := s.client.Get(ctx, s.prefix+key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return Record{}, ErrNotFound
+	}
+	if err != nil {
+		return Record{}, err
+	}
+
+	var rec Record
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return Record{}, err
+	}
+	if rec.Expired(time.Now()) {
+		return Record{}, ErrNotFound
+	}
+	return rec, nil
+}
+
+// TakeOnce implements SecretStore. Once fn has returned its result is stored
+// even if ctx is cancelled, so a client disconnecting cannot undo a counted
+// view or failed attempt.
+func (s *RedisStore) TakeOnce(ctx context.Context, key string, fn TakeFunc) error {
+	k := s.prefix + key
+	for {
+		data, err := s.client.Get(ctx, k).Bytes()
+		if errors.Is(err, redis.Nil) {
+			return ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		var rec Record
+		if err := json.Unmarshal(data, &rec); err != nil {
+			return err
+		}
+		var updated *Record
+		expired := rec.Expired(time.Now())
+		if !expired {
+			if updated, err = fn(rec); err != nil {
+				return err
+			}
+		}
+
+		swapped, err := s.swap(ctx, k, data, updated)
+		switch {
+		case err != nil:
+			return err
+		case !swapped:
+			continue
+		case expired:
+			return ErrNotFound
+		}
+		return nil
+	}
+}
+
+// swap replaces the value old of the Redis key k with rec, or deletes it if
+// rec is nil or has expired. It reports whether k still held old.
+func (s *RedisStore) swap(ctx context.Context, k string, old []byte, rec *Record) (bool, error) {
+	var data []byte
+	var ttl time.Duration
+	if rec != nil && (rec.ExpiresAt.IsZero() || time.Until(rec.ExpiresAt) > 0) {
+		var err error
+		if data, err = json.Marshal(rec); err != nil {
+			return false, err
+		}
+		if !rec.ExpiresAt.IsZero() {
+			ttl = max(time.Until(rec.ExpiresAt), time.Millisecond)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), redisWriteTimeout)
+	defer cancel()
+	n, err := swapScript.Run(ctx, s.client, []string{k}, old, data, ttl.Milliseconds()).Int()
+	return n == 1, err
+}
+
+// Delete implements SecretStore.
+func (s *RedisStore) Delete(ctx context.Context, key string) error {
+	return s.client.Del(ctx, s.prefix+key).Err()
+}
+
+// Expire implements SecretStore. Redis removes expired records itself, so
+// there is nothing left to remove.
+func (s *RedisStore) Expire(context.Context, time.Time) (int, error) {
+	return 0, nil
+}
+
+// Stats implements SecretStore. Redis keeps no count of the keys matching a
+// prefix, so Stats SCANs every key in the database, including those of other
+// applications sharing it. Callers polling it should cache the result.
+func (s *RedisStore) Stats(ctx context.Context) (Stats, error) {
+	var stats Stats
+	iter := s.client.Scan(ctx, 0, s.prefix+"*", 1000).Iterator()
+	for iter.Next(ctx) {
+		stats.Secrets++
+	}
+	return stats, iter.Err()
+}
+
+// Close implements SecretStore.
+func (s *RedisStore) Close() error {
+	return s.client.Close()
+}
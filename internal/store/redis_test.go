@@ -0,0 +1,113 @@
+package store
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestRedisStore(t *testing.T) {
+	testSecretStore(t, func(t *testing.T) SecretStore {
+		m := miniredis.RunT(t)
+		return NewRedis(redis.NewClient(&redis.Options{Addr: m.Addr()}))
+	})
+}
+
+// TestRedisStore_Server runs the conformance suite against the Redis server in
+// GRB_TEST_REDIS_URL, if set. Each test uses its own key prefix.
+func TestRedisStore_Server(t *testing.T) {
+	url := os.Getenv("GRB_TEST_REDIS_URL")
+	if url == "" {
+		t.Skip("GRB_TEST_REDIS_URL is not set")
+	}
+	testSecretStore(t, func(t *testing.T) SecretStore {
+		s, err := OpenRedis(url)
+		if err != nil {
+			t.Fatalf("OpenRedis() error: %v", err)
+		}
+		s.prefix = "grbtest:" + strings.ReplaceAll(t.Name(), "/", ":") + ":" + time.Now().Format(time.RFC3339Nano) + ":"
+		return s
+	})
+}
+
+func TestRedisStore_NativeExpiry(t *testing.T) {
+	m := miniredis.RunT(t)
+	s := NewRedis(redis.NewClient(&redis.Options{Addr: m.Addr()}))
+	defer s.Close()
+
+	if err := s.Put(t.Context(), "key00001", Record{Ciphertext: []byte("ct"), ExpiresAt: time.Now().Add(time.Minute)}); err != nil {
+		t.Fatalf("Put() error: %v", err)
+	}
+	if ttl := m.TTL(redisKeyPrefix + "key00001"); ttl <= 59*time.Second || ttl > time.Minute {
+		t.Errorf("key TTL = %v, want 1m", ttl)
+	}
+
+	m.FastForward(time.Minute)
+	if _, err := s.Get(t.Context(), "key00001"); err != ErrNotFound {
+		t.Errorf("Get() after TTL error = %v, want %v", err, ErrNotFound)
+	}
+}
+
+func TestRedisStore_TakeOnceKeepsRecordVisible(t *testing.T) {
+	m := miniredis.RunT(t)
+	s := NewRedis(redis.NewClient(&redis.Options{Addr: m.Addr()}))
+	defer s.Close()
+
+	if err := s.Put(t.Context(), "key00001", Record{Ciphertext: []byte("ct"), ExpiresAt: time.Now().Add(time.Hour), RemainingViews: 2}); err != nil {
+		t.Fatalf("Put() error: %v", err)
+	}
+	err := s.TakeOnce(t.Context(), "key00001", func(rec Record) (*Record, error) {
+		// Other viewers of a multi-view secret must not see it as gone.
+		if _, err := s.Get(t.Context(), "key00001"); err != nil {
+			t.Errorf("Get() during TakeOnce error: %v", err)
+		}
+		rec.RemainingViews--
+		return &rec, nil
+	})
+	if err != nil {
+		t.Fatalf("TakeOnce() error: %v", err)
+	}
+	if ttl := m.TTL(redisKeyPrefix + "key00001"); ttl <= 59*time.Minute {
+		t.Errorf("key TTL after TakeOnce = %v, want about 1h", ttl)
+	}
+}
+
+func TestRedisStore_TakeOnceCancelled(t *testing.T) {
+	m := miniredis.RunT(t)
+	s := NewRedis(redis.NewClient(&redis.Options{Addr: m.Addr()}))
+	defer s.Close()
+
+	if err := s.Put(t.Context(), "key00001", Record{Ciphertext: []byte("ct"), ExpiresAt: time.Now().Add(time.Hour), RemainingViews: 2}); err != nil {
+		t.Fatalf("Put() error: %v", err)
+	}
+
+	// A client disconnecting while fn runs must neither destroy the secret
+	// nor lose its update.
+	ctx, cancel := context.WithCancel(t.Context())
+	err := s.TakeOnce(ctx, "key00001", func(rec Record) (*Record, error) {
+		cancel()
+		rec.FailedAttempts++
+		return &rec, nil
+	})
+	if err != nil {
+		t.Fatalf("TakeOnce() error: %v", err)
+	}
+	got, err := s.Get(t.Context(), "key00001")
+	if err != nil || got.FailedAttempts != 1 {
+		t.Errorf("Get() after cancelled TakeOnce = %+v, %v, want the updated record", got, err)
+	}
+}
+
+func TestOpenRedis_Unreachable(t *testing.T) {
+	if _, err := OpenRedis("redis://127.0.0.1:1/0"); err == nil {
+		t.Error("OpenRedis() of an unreachable server succeeded")
+	}
+	if _, err := OpenRedis("not a url"); err == nil {
+		t.Error("OpenRedis() with an invalid URL succeeded")
+	}
+}
@@ -0,0 +1,290 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	// Register the pgx and sqlite database/sql drivers.
+	_ "github.com/jackc/pgx/v5/stdlib"
+	_ "modernc.org/sqlite"
+)
+
+// sqlDialect holds what differs between the databases supported by SQLStore.
+type sqlDialect struct {
+	// driver is the database/sql driver name.
+	driver string
+	// lockMigrations is run at the start of the migration transaction, before
+	// schema_migrations is created, to stop concurrently starting instances
+	// migrating at the same time.
+	lockMigrations string
+	// migrations are the statements creating the schema. The schema version
+	// is the number of migrations applied, so statements must only ever be
+	// appended.
+	migrations []string
+}
+
+// migrationLockID is the key of the PostgreSQL advisory lock held while
+// migrating.
+const migrationLockID = "7239162351018390130"
+
+var sqlDialects = map[string]sqlDialect{
+	BackendSQLite: {
+		driver: "sqlite",
+		migrations: []string{
+			`CREATE TABLE secrets (
+				key TEXT PRIMARY KEY,
+				ciphertext BLOB NOT NULL,
+				expires_at BIGINT,
+				client_encrypted BOOLEAN NOT NULL DEFAULT FALSE,
+				passphrase BOOLEAN NOT NULL DEFAULT FALSE,
+				failed_attempts INTEGER NOT NULL DEFAULT 0,
+				remaining_views INTEGER NOT NULL DEFAULT 0,
+				file BOOLEAN NOT NULL DEFAULT FALSE
+			)`,
+			`CREATE INDEX secrets_expires_at ON secrets (expires_at)`,
+			`ALTER TABLE secrets ADD COLUMN kdf TEXT NOT NULL DEFAULT ''`,
+			`ALTER TABLE secrets ADD COLUMN version INTEGER NOT NULL DEFAULT 0`,
+		},
+	},
+	BackendPostgres: {
+		driver:         "pgx",
+		lockMigrations: `SELECT pg_advisory_xact_lock(` + migrationLockID + `)`,
+		migrations: []string{
+			`CREATE TABLE secrets (
+				key TEXT PRIMARY KEY,
+				ciphertext BYTEA NOT NULL,
+				expires_at BIGINT,
+				client_encrypted BOOLEAN NOT NULL DEFAULT FALSE,
+				passphrase BOOLEAN NOT NULL DEFAULT FALSE,
+				failed_attempts INTEGER NOT NULL DEFAULT 0,
+				remaining_views INTEGER NOT NULL DEFAULT 0,
+				file BOOLEAN NOT NULL DEFAULT FALSE
+			)`,
+			`CREATE INDEX secrets_expires_at ON secrets (expires_at)`,
+			`ALTER TABLE secrets ADD COLUMN kdf TEXT NOT NULL DEFAULT ''`,
+			`ALTER TABLE secrets ADD COLUMN version INTEGER NOT NULL DEFAULT 0`,
+		},
+	},
+}
+
+// sqlColumns are the columns holding a Record, in the order scanRecord reads
+// them.
+const sqlColumns = `ciphertext, expires_at, client_encrypted, passphrase, failed_attempts, remaining_views, file, kdf`
+
+// SQLStore is a SecretStore backed by a SQL database, either SQLite for a
+// single instance or PostgreSQL for instances sharing a database. Expiry times
+// are stored as Unix milliseconds in an indexed column, so expired rows can be
+// swept without a table scan.
+type SQLStore struct {
+	db *sql.DB
+}
+
+// OpenSQL opens the database at dsn with the BackendSQLite or BackendPostgres
+// backend and migrates its schema to the latest version.
+func OpenSQL(backend, dsn string) (*SQLStore, error) {
+	dialect, ok := sqlDialects[backend]
+	if !ok {
+		return nil, fmt.Errorf("unsupported SQL backend %q", backend)
+	}
+	if dsn == "" {
+		return nil, errors.New("no database URL given")
+	}
+
+	db, err := sql.Open(dialect.driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+	if backend == BackendSQLite {
+		// SQLite allows a single writer, so sharing one connection queues
+		// writes instead of failing them with SQLITE_BUSY.
+		db.SetMaxOpenConns(1)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := migrate(ctx, db, dialect); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to migrate database: %w", err)
+	}
+	return &SQLStore{db: db}, nil
+}
+
+// migrate applies the migrations of dialect that have not been applied to db
+// yet, in a single transaction that also creates the schema_migrations table.
+func migrate(ctx context.Context, db *sql.DB, dialect sqlDialect) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if dialect.lockMigrations != "" {
+		if _, err := tx.ExecContext(ctx, dialect.lockMigrations); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (version INTEGER PRIMARY KEY)`); err != nil {
+		return err
+	}
+	var version int
+	if err := tx.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&version); err != nil {
+		return err
+	}
+	if version > len(dialect.migrations) {
+		return fmt.Errorf("database schema version %d is newer than this release supports", version)
+	}
+
+	for i := version; i < len(dialect.migrations); i++ {
+		if _, err := tx.ExecContext(ctx, dialect.migrations[i]); err != nil {
+			return fmt.Errorf("migration %d: %w", i+1, err)
+		}
+		if _, err := tx.ExecContext(ctx, `INSERT INTO schema_migrations (version) VALUES ($1)`, i+1); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// toMillis converts an expiry time to the value stored in expires_at.
+func toMillis(t time.Time) sql.NullInt64 {
+	if t.IsZero() {
+		return sql.NullInt64{}
+	}
+	return sql.NullInt64{Int64: t.UnixMilli(), Valid: true}
+}
+
+// scanRecord reads the sqlColumns of a row into a Record, after any columns
+// selected in front of them into dest.
+func scanRecord(row interface{ Scan(...any) error }, dest ...any) (Record, error) {
+	var rec Record
+	var expiresAt sql.NullInt64
+	err := row.Scan(append(dest, &rec.Ciphertext, &expiresAt, &rec.ClientEncrypted, &rec.Passphrase, &rec.FailedAttempts, &rec.RemainingViews, &rec.File, &rec.KDF)...)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Record{}, ErrNotFound
+	}
+	if err != nil {
+		return Record{}, err
+	}
+	if expiresAt.Valid {
+		rec.ExpiresAt = time.UnixMilli(expiresAt.Int64).UTC()
+	}
+	return rec, nil
+}
+
+// execer is implemented by *sql.DB and *sql.Tx.
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// insert stores rec under key, or returns ErrKeyExists if key is in use.
+func insert(ctx context.Context, exec execer, key string, rec Record) error {
+	res, err := exec.ExecContext(ctx,
+		`INSERT INTO secrets (key, `+sqlColumns+`) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) ON CONFLICT (key) DO NOTHING`,
+		key, rec.Ciphertext, toMillis(rec.ExpiresAt), rec.ClientEncrypted, rec.Passphrase, rec.FailedAttempts, rec.RemainingViews, rec.File, rec.KDF)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrKeyExists
+	}
+	return nil
+}
+
+// Put implements SecretStore.
+func (s *SQLStore) Put(ctx context.Context, key string, rec Record) error {
+	return insert(ctx, s.db, key, rec)
+}
+
+// Get implements SecretStore.
+func (s *SQLStore) Get(ctx context.Context, key string) (Record, error) {
+	return scanRecord(s.db.QueryRowContext(ctx,
+		`SELECT `+sqlColumns+` FROM secrets WHERE key = $1 AND (expires_at IS NULL OR expires_at > $2)`,
+		key, time.Now().UnixMilli()))
+}
+
+// TakeOnce implements SecretStore. The row is read without a transaction, so
+// fn never holds a connection or a row lock. Its version column is bumped by
+// every update, and the result of fn is only written while the row is still
+// at the version passed to fn: the last view is read and burnt by a single
+// DELETE ... RETURNING statement, other views by an UPDATE.
+func (s *SQLStore) TakeOnce(ctx context.Context, key string, fn TakeFunc) error {
+	for {
+		var version int64
+		rec, err := scanRecord(s.db.QueryRowContext(ctx, `SELECT version, `+sqlColumns+` FROM secrets WHERE key = $1`, key), &version)
+		if err != nil {
+			return err
+		}
+		if rec.Expired(time.Now()) {
+			_, err := s.db.ExecContext(ctx, `DELETE FROM secrets WHERE key = $1 AND expires_at <= $2`, key, time.Now().UnixMilli())
+			if err != nil {
+				return err
+			}
+			return ErrNotFound
+		}
+
+		updated, err := fn(rec)
+		if err != nil {
+			return err
+		}
+
+		if updated == nil {
+			_, err = scanRecord(s.db.QueryRowContext(ctx,
+				`DELETE FROM secrets WHERE key = $1 AND version = $2 RETURNING `+sqlColumns, key, version))
+			if !errors.Is(err, ErrNotFound) {
+				return err
+			}
+			// The row changed or was removed while fn ran.
+			continue
+		}
+
+		res, err := s.db.ExecContext(ctx,
+			`UPDATE secrets SET version = version + 1, ciphertext = $3, expires_at = $4, client_encrypted = $5, passphrase = $6, failed_attempts = $7, remaining_views = $8, file = $9, kdf = $10 WHERE key = $1 AND version = $2`,
+			key, version, updated.Ciphertext, toMillis(updated.ExpiresAt), updated.ClientEncrypted, updated.Passphrase, updated.FailedAttempts, updated.RemainingViews, updated.File, updated.KDF)
+		if err != nil {
+			return err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			return nil
+		}
+		// The row changed or was removed while fn ran.
+	}
+}
+
+// Delete implements SecretStore.
+func (s *SQLStore) Delete(ctx context.Context, key string) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM secrets WHERE key = $1`, key)
+	return err
+}
+
+// Expire implements SecretStore.
+func (s *SQLStore) Expire(ctx context.Context, now time.Time) (int, error) {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM secrets WHERE expires_at <= $1`, now.UnixMilli())
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+// Stats implements SecretStore.
+func (s *SQLStore) Stats(ctx context.Context) (Stats, error) {
+	var stats Stats
+	err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM secrets`).Scan(&stats.Secrets)
+	return stats, err
+}
+
+// Close implements SecretStore.
+func (s *SQLStore) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,159 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSQLStore_SQLite(t *testing.T) {
+	testSecretStore(t, func(t *testing.T) SecretStore {
+		s, err := OpenSQL(BackendSQLite, filepath.Join(t.TempDir(), "secrets.sqlite"))
+		if err != nil {
+			t.Fatalf("OpenSQL() error: %v", err)
+		}
+		return s
+	})
+}
+
+// TestSQLStore_Postgres runs the conformance suite against the PostgreSQL
+// database in GRB_TEST_POSTGRES_URL, if set. The secrets table is emptied
+// before each test.
+func TestSQLStore_Postgres(t *testing.T) {
+	dsn := os.Getenv("GRB_TEST_POSTGRES_URL")
+	if dsn == "" {
+		t.Skip("GRB_TEST_POSTGRES_URL is not set")
+	}
+	testSecretStore(t, func(t *testing.T) SecretStore {
+		s, err := OpenSQL(BackendPostgres, dsn)
+		if err != nil {
+			t.Fatalf("OpenSQL() error: %v", err)
+		}
+		if _, err := s.db.Exec(`DELETE FROM secrets`); err != nil {
+			t.Fatal(err)
+		}
+		return s
+	})
+}
+
+func TestOpenSQL_MigratesOnce(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secrets.sqlite")
+	s, err := Open(Config{Backend: BackendSQLite, DatabaseURL: path})
+	if err != nil {
+		t.Fatalf("Open(sqlite) error: %v", err)
+	}
+	if err := s.Put(t.Context(), "key00001", Record{Ciphertext: []byte("ct"), ExpiresAt: time.Now().Add(time.Hour)}); err != nil {
+		t.Fatalf("Put() error: %v", err)
+	}
+	s.Close()
+
+	// Reopening must keep the data and not re-run the migrations.
+	reopened, err := OpenSQL(BackendSQLite, path)
+	if err != nil {
+		t.Fatalf("OpenSQL() of a migrated database error: %v", err)
+	}
+	defer reopened.Close()
+	if _, err := reopened.Get(t.Context(), "key00001"); err != nil {
+		t.Errorf("Get() after reopening error: %v", err)
+	}
+
+	var version int
+	if err := reopened.db.QueryRow(`SELECT MAX(version) FROM schema_migrations`).Scan(&version); err != nil {
+		t.Fatal(err)
+	}
+	if want := len(sqlDialects[BackendSQLite].migrations); version != want {
+		t.Errorf("schema version = %d, want %d", version, want)
+	}
+}
+
+func TestOpenSQL_MigratesExistingRows(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secrets.sqlite")
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Create a database at schema version 2, before the kdf column existed.
+	dialect := sqlDialects[BackendSQLite]
+	old := sqlDialect{driver: dialect.driver, migrations: dialect.migrations[:2]}
+	if err := migrate(t.Context(), db, old); err != nil {
+		t.Fatalf("migrate() error: %v", err)
+	}
+	_, err = db.Exec(`INSERT INTO secrets (key, ciphertext) VALUES ('key00001', 'ct')`)
+	db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := OpenSQL(BackendSQLite, path)
+	if err != nil {
+		t.Fatalf("OpenSQL() error: %v", err)
+	}
+	defer s.Close()
+	rec, err := s.Get(t.Context(), "key00001")
+	if err != nil {
+		t.Fatalf("Get() of a migrated row error: %v", err)
+	}
+	if string(rec.Ciphertext) != "ct" || rec.KDF != "" {
+		t.Errorf("Get() of a migrated row = %+v, want ciphertext %q and no KDF", rec, "ct")
+	}
+}
+
+func TestOpenSQL_NewerSchema(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secrets.sqlite")
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec(fmt.Sprintf(`CREATE TABLE schema_migrations (version INTEGER PRIMARY KEY);
+		INSERT INTO schema_migrations (version) VALUES (%d)`, len(sqlDialects[BackendSQLite].migrations)+1))
+	db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := OpenSQL(BackendSQLite, path); err == nil {
+		t.Error("OpenSQL() of a database from a newer release succeeded")
+	}
+}
+
+func TestOpenSQL_Errors(t *testing.T) {
+	if _, err := OpenSQL("oracle", "dsn"); err == nil {
+		t.Error("OpenSQL() with an unsupported backend succeeded")
+	}
+	if _, err := OpenSQL(BackendSQLite, ""); err == nil {
+		t.Error("OpenSQL() without a database URL succeeded")
+	}
+}
+
+func TestSQLStore_ExpiresAtIndex(t *testing.T) {
+	s, err := OpenSQL(BackendSQLite, filepath.Join(t.TempDir(), "secrets.sqlite"))
+	if err != nil {
+		t.Fatalf("OpenSQL() error: %v", err)
+	}
+	defer s.Close()
+
+	rows, err := s.db.Query(`EXPLAIN QUERY PLAN DELETE FROM secrets WHERE expires_at <= $1`, time.Now().UnixMilli())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var plan string
+	for rows.Next() {
+		var id, parent, unused int
+		var detail string
+		if err := rows.Scan(&id, &parent, &unused, &detail); err != nil {
+			t.Fatal(err)
+		}
+		plan += detail + "\n"
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(plan, "secrets_expires_at") {
+		t.Errorf("sweeping expired secrets does not use the expiry index:\n%s", plan)
+	}
+}
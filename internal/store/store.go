@@ -0,0 +1,128 @@
+// Package store persists encrypted secrets for go-read-burn. A SecretStore only
+// ever holds ciphertext and the metadata needed to serve it; secrets are
+// encrypted and decrypted by the caller.
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	// ErrKeyExists is returned by Put when a record is already stored under
+	// the key.
+	ErrKeyExists = errors.New("key already exists")
+	// ErrNotFound is returned when no unexpired record is stored under a key.
+	ErrNotFound = errors.New("secret not found")
+)
+
+// Record is an encrypted secret and its metadata.
+type Record struct {
+	Ciphertext      []byte    `json:"ciphertext"`
+	ExpiresAt       time.Time `json:"expires_at"`
+	ClientEncrypted bool      `json:"client_encrypted,omitempty"`
+	Passphrase      bool      `json:"passphrase,omitempty"`
+	FailedAttempts  int       `json:"failed_attempts,omitempty"`
+	RemainingViews  int       `json:"remaining_views,omitempty"`
+	File            bool      `json:"file,omitempty"`
+	// KDF holds the key derivation parameters the ciphertext was encrypted
+	// with, as encoded by crypto.KDFParams. Records written before it was
+	// stored leave it empty.
+	KDF string `json:"kdf,omitempty"`
+}
+
+// Expired reports whether the record has passed its expiry time. Records
+// without an expiry never expire.
+func (r Record) Expired(now time.Time) bool {
+	return !r.ExpiresAt.IsZero() && !now.Before(r.ExpiresAt)
+}
+
+// Views returns the number of times the record can still be revealed. A record
+// stored without RemainingViews can be revealed once.
+func (r Record) Views() int {
+	if r.RemainingViews < 1 {
+		return 1
+	}
+	return r.RemainingViews
+}
+
+// Stats describes the contents of a SecretStore.
+type Stats struct {
+	// Secrets is the number of stored records, including expired records
+	// that have not been removed by Expire yet. It is approximate for
+	// backends that count while records are being written.
+	Secrets int
+}
+
+// TakeFunc is called by TakeOnce with the record stored under a key. It
+// returns the record to store in its place, or nil to delete it. If it
+// returns an error the stored record is left unchanged. It may be called more
+// than once for a single TakeOnce, so slow work such as decryption belongs
+// before the call rather than in fn.
+type TakeFunc func(rec Record) (*Record, error)
+
+// SecretStore stores records keyed by the key component of a secret ID.
+// Implementations must be safe for concurrent use.
+type SecretStore interface {
+	// Put stores rec under key, or returns ErrKeyExists if key is in use.
+	Put(ctx context.Context, key string, rec Record) error
+	// Get returns the unexpired record stored under key without modifying
+	// it, or ErrNotFound.
+	Get(ctx context.Context, key string) (Record, error)
+	// TakeOnce passes the unexpired record stored under key to fn and
+	// replaces or deletes it as fn returns. The store is not locked while fn
+	// runs; if the record changes in the meantime the result of fn is
+	// discarded and fn is called again with the current record, so each
+	// version of a record is taken at most once. An expired record is
+	// deleted and ErrNotFound returned without calling fn.
+	TakeOnce(ctx context.Context, key string, fn TakeFunc) error
+	// Delete removes the record stored under key, if any.
+	Delete(ctx context.Context, key string) error
+	// Expire removes all records that have expired as of now and returns the
+	// number removed.
+	Expire(ctx context.Context, now time.Time) (int, error)
+	// Stats returns statistics about the stored records.
+	Stats(ctx context.Context) (Stats, error)
+	// Close releases the resources held by the store.
+	Close() error
+}
+
+// Backends supported by Open.
+const (
+	BackendBolt     = "bolt"
+	BackendMemory   = "memory"
+	BackendRedis    = "redis"
+	BackendSQLite   = "sqlite"
+	BackendPostgres = "postgres"
+)
+
+// Config selects and configures the backend opened by Open.
+type Config struct {
+	// Backend is the name of the backend to use.
+	Backend string
+	// BoltPath is the path of the bolt database file.
+	BoltPath string
+	// RedisURL is the URL of the Redis server.
+	RedisURL string
+	// DatabaseURL is the data source name of the SQLite or PostgreSQL
+	// database.
+	DatabaseURL string
+}
+
+// Open opens the SecretStore selected by cfg.
+func Open(cfg Config) (SecretStore, error) {
+	switch cfg.Backend {
+	case BackendBolt:
+		return OpenBolt(cfg.BoltPath)
+	case BackendMemory:
+		return NewMemory(), nil
+	case BackendRedis:
+		return OpenRedis(cfg.RedisURL)
+	case BackendSQLite, BackendPostgres:
+		return OpenSQL(cfg.Backend, cfg.DatabaseURL)
+	default:
+		return nil, fmt.Errorf("unknown store backend %q", cfg.Backend)
+	}
+}